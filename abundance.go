@@ -0,0 +1,152 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Abundance estimation from equivalence class counts.
+*/
+package fmic
+
+import (
+	"math"
+)
+
+type EMOptions struct {
+	FragmentLength float64     // mean fragment length (default: 200)
+	EffLength      []float64   // effective lengths; computed from FragmentLength if nil
+	MaxIterations  int         // default: 1000
+	Tolerance      float64     // stop when no abundance changes by more than this (default: 1e-8)
+	Bias           BiasOptions // correct EffLength with models learned from EqCounts.Bias
+}
+
+// Transcript-level abundances, indexed like GENOME_ID (without the decoys).
+type Abundance struct {
+	IDs       []string
+	Length    []float64
+	EffLength []float64
+	NumReads  []float64 // estimated number of read pairs
+	TPM       []float64
+	Bias      *BiasModel // the learned models, if opt.Bias is set
+}
+
+//-----------------------------------------------------------------------------
+func (opt EMOptions) withDefaults() EMOptions {
+	if opt.FragmentLength <= 0 {
+		opt.FragmentLength = 200
+	}
+	if opt.MaxIterations <= 0 {
+		opt.MaxIterations = 1000
+	}
+	if opt.Tolerance <= 0 {
+		opt.Tolerance = 1e-8
+	}
+	return opt
+}
+
+//-----------------------------------------------------------------------------
+// Effective length of each sequence: the number of positions at which a
+// fragment of the mean length can start, but at least 1.
+//-----------------------------------------------------------------------------
+func (I *IndexC) EffectiveLengths(fragment_length float64) []float64 {
+	eff_len := make([]float64, len(I.LENS))
+	for k, l := range I.LENS {
+		eff_len[k] = math.Max(float64(l)-fragment_length+1, 1)
+	}
+	return eff_len
+}
+
+//-----------------------------------------------------------------------------
+// Estimate the number of read pairs from each target sequence by expectation
+// maximization over the equivalence classes.  Decoys are left out.  With
+// bias correction, the bias models are learned from a first estimate, and
+// the estimate is repeated with the effective lengths they imply.  If they
+// cannot be learned, e.g. because no fragment is assigned to a single
+// target, the first estimate is returned, and its Bias is nil.
+//-----------------------------------------------------------------------------
+func (I *IndexC) EstimateAbundance(E *EqCounts, opt EMOptions) *Abundance {
+	opt = opt.withDefaults()
+	if opt.Bias.any() {
+		if E.Bias == nil {
+			panic("EstimateAbundance: bias correction needs the fragments counted with QuantOptions.Bias")
+		}
+		uncorrected := opt
+		uncorrected.Bias = BiasOptions{}
+		A := I.EstimateAbundance(E, uncorrected)
+		model, err := I.LearnBias(E.Bias, A, opt.Bias, opt.FragmentLength)
+		if err != nil {
+			return A
+		}
+		opt.Bias, opt.EffLength = BiasOptions{}, model.EffLength
+		A = I.EstimateAbundance(E, opt)
+		A.Bias = model
+		return A
+	}
+	n := I.NumTargets()
+	A := &Abundance{IDs: I.GENOME_ID[:n], EffLength: opt.EffLength}
+	if A.EffLength == nil {
+		A.EffLength = I.EffectiveLengths(opt.FragmentLength)[:n]
+	}
+	A.Length = make([]float64, n)
+	for k := range A.Length {
+		A.Length[k] = float64(I.LENS[k])
+	}
+	A.NumReads = runEM(E.sortedClasses(), E.Assigned, A.EffLength, opt)
+	A.TPM = computeTPM(A.NumReads, A.EffLength)
+	return A
+}
+
+//-----------------------------------------------------------------------------
+// The classes are in a fixed order, so that the sums, and the estimates, do
+// not depend on the order of a map.
+//-----------------------------------------------------------------------------
+func runEM(classes []*EqClass, assigned int, eff_len []float64, opt EMOptions) []float64 {
+	n := len(eff_len)
+	alpha := make([]float64, n)
+	next := make([]float64, n)
+	for k := range alpha {
+		alpha[k] = float64(assigned) / float64(n)
+	}
+	for iter := 0; iter < opt.MaxIterations; iter++ {
+		for k := range next {
+			next[k] = 0
+		}
+		for _, class := range classes {
+			denom := 0.0
+			for _, id := range class.IDs {
+				denom += alpha[id] / eff_len[id]
+			}
+			if denom <= 0 {
+				continue
+			}
+			for _, id := range class.IDs {
+				next[id] += float64(class.Count) * alpha[id] / eff_len[id] / denom
+			}
+		}
+		converged := true
+		for k := range alpha {
+			if math.Abs(next[k]-alpha[k]) > opt.Tolerance*math.Max(alpha[k], 1) {
+				converged = false
+			}
+		}
+		alpha, next = next, alpha
+		if converged {
+			break
+		}
+	}
+	return alpha
+}
+
+//-----------------------------------------------------------------------------
+func computeTPM(num_reads, eff_len []float64) []float64 {
+	tpm := make([]float64, len(num_reads))
+	total := 0.0
+	for k := range num_reads {
+		tpm[k] = num_reads[k] / eff_len[k]
+		total += tpm[k]
+	}
+	if total > 0 {
+		for k := range tpm {
+			tpm[k] *= 1e6 / total
+		}
+	}
+	return tpm
+}
+
+//-----------------------------------------------------------------------------
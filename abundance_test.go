@@ -0,0 +1,37 @@
+package fmic
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEstimateAbundance(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	I := CompressedIndex(writeFasta(t, []string{randSeq(r, 300), randSeq(r, 300), randSeq(r, 150)}), true, 4)
+	E := NewEqCounts()
+	E.Add([]int{0}, 100)
+	E.Add([]int{1}, 300)
+	E.Add([]int{0, 1}, 100)
+	A := I.EstimateAbundance(E, EMOptions{})
+
+	// The shared pairs split 1:3, like the unique ones.
+	want := []float64{125, 375, 0}
+	for k := range want {
+		if math.Abs(A.NumReads[k]-want[k]) > 1e-3 {
+			t.Errorf("sequence %d has %f pairs instead of %f", k, A.NumReads[k], want[k])
+		}
+	}
+	if A.EffLength[0] != 101 || A.EffLength[2] != 1 {
+		t.Errorf("effective lengths %v", A.EffLength)
+	}
+	if math.Abs(A.TPM[0]-2.5e5) > 1 || math.Abs(A.TPM[1]-7.5e5) > 1 || A.TPM[2] != 0 {
+		t.Errorf("TPM %v", A.TPM)
+	}
+
+	// Given effective lengths weigh the shared pairs.
+	A = I.EstimateAbundance(E, EMOptions{EffLength: []float64{100, 100, 100}})
+	if math.Abs(A.NumReads[0]-125) > 1e-3 {
+		t.Errorf("sequence 0 has %f pairs", A.NumReads[0])
+	}
+}
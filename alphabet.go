@@ -0,0 +1,180 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Normalization of the symbols of the text and of queries.
+*/
+package fmic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// What to do with the IUPAC ambiguity codes, N included.
+type AmbiguityPolicy int
+
+const (
+	KeepAmbiguous   AmbiguityPolicy = iota // keep them as they are
+	AmbiguousToN                           // map them to N
+	AmbiguousToBase                        // map them to one of the bases they stand for, at random
+)
+
+// The bases of each IUPAC ambiguity code.
+var iupac_bases = map[byte]string{
+	'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT", 'K': "GT", 'M': "AC",
+	'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG", 'N': "ACGT",
+}
+
+//-----------------------------------------------------------------------------
+// Alphabet normalizes the text of an index when it is built, and queries the
+// same way when they are searched.  The zero value keeps every symbol.
+// Random choices depend only on Seed and the position of the symbol, so the
+// same read is always normalized the same way.
+//-----------------------------------------------------------------------------
+type Alphabet struct {
+	FoldCase  bool            // map lowercase letters to uppercase
+	Ambiguous AmbiguityPolicy // what to do with ambiguity codes, in either case
+	Seed      int64           // seed of AmbiguousToBase
+	SplitAtN  bool            // end the seeds of queries at N, instead of matching it
+}
+
+//-----------------------------------------------------------------------------
+// The policy as one word without spaces, as saved in "others".
+//-----------------------------------------------------------------------------
+func (a Alphabet) String() string {
+	return fmt.Sprintf("fold=%t,ambiguous=%d,seed=%d,split=%t", a.FoldCase, a.Ambiguous, a.Seed, a.SplitAtN)
+}
+
+func parseAlphabet(s string) (Alphabet, error) {
+	var a Alphabet
+	if _, err := fmt.Sscanf(s, "fold=%t,ambiguous=%d,seed=%d,split=%t", &a.FoldCase, &a.Ambiguous, &a.Seed, &a.SplitAtN); err != nil {
+		return a, fmt.Errorf("invalid alphabet %q: %v", s, err)
+	}
+	return a, a.check()
+}
+
+func (a Alphabet) check() error {
+	if a.Ambiguous < KeepAmbiguous || a.Ambiguous > AmbiguousToBase {
+		return fmt.Errorf("unknown ambiguity policy %d", a.Ambiguous)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// normalizer applies an alphabet through tables of all 256 bytes.
+//-----------------------------------------------------------------------------
+type normalizer struct {
+	table [256]byte
+	bases [256]string // the bases of each symbol that is changed at random
+	seed  uint64
+}
+
+//-----------------------------------------------------------------------------
+// The normalizer of the text, or of queries, in which N is kept if seeds end
+// at it.  It is nil if the alphabet keeps every symbol.
+//-----------------------------------------------------------------------------
+func (a Alphabet) normalizer(query bool) *normalizer {
+	if a == (Alphabet{}) {
+		return nil
+	}
+	n := &normalizer{seed: uint64(a.Seed)}
+	for i := range n.table {
+		c := byte(i)
+		if a.FoldCase && 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper, lower := c, false
+		if 'a' <= c && c <= 'z' {
+			upper, lower = c-('a'-'A'), true
+		}
+		if b, ok := iupac_bases[upper]; ok && !(query && a.SplitAtN && upper == 'N') {
+			switch a.Ambiguous {
+			case AmbiguousToN:
+				c = 'N'
+				if lower {
+					c = 'n'
+				}
+			case AmbiguousToBase:
+				if lower {
+					b = strings.ToLower(b)
+				}
+				n.bases[i] = b
+			}
+		}
+		n.table[i] = c
+	}
+	return n
+}
+
+//-----------------------------------------------------------------------------
+// Normalize s in place; random choices depend on the position in s.
+//-----------------------------------------------------------------------------
+func (n *normalizer) apply(s []byte) {
+	for p, c := range s {
+		if b := n.bases[c]; b != "" {
+			s[p] = b[splitmix64(n.seed+uint64(p))%uint64(len(b))]
+		} else {
+			s[p] = n.table[c]
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// A well mixed hash of x, for random choices that depend only on x.
+//-----------------------------------------------------------------------------
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+//-----------------------------------------------------------------------------
+// Returns the query normalized by the alphabet of the index; it is a copy if
+// the alphabet changes anything.
+//-----------------------------------------------------------------------------
+func (I *IndexC) normalizeQuery(query []byte) []byte {
+	if I.query_normalizer == nil {
+		return query
+	}
+	q := append([]byte(nil), query...)
+	I.query_normalizer.apply(q)
+	return q
+}
+
+//-----------------------------------------------------------------------------
+func (I *IndexC) setAlphabet(a Alphabet) error {
+	if err := a.check(); err != nil {
+		return err
+	}
+	I.ALPHABET = a
+	I.query_normalizer = a.normalizer(true)
+	return nil
+}
+
+func isN(c byte) bool {
+	return c == 'N' || c == 'n'
+}
+
+//-----------------------------------------------------------------------------
+// Where seeds of the query start: at the longest run without N if seeds end
+// at N, and at 0 otherwise.
+//-----------------------------------------------------------------------------
+func (I *IndexC) seedStart(query []byte) int {
+	if !I.ALPHABET.SplitAtN {
+		return 0
+	}
+	best, best_len := 0, 0
+	for i := 0; i < len(query); {
+		j := i
+		for j < len(query) && !isN(query[j]) {
+			j++
+		}
+		if j-i > best_len {
+			best, best_len = i, j-i
+		}
+		i = j + 1
+	}
+	return best
+}
+
+//-----------------------------------------------------------------------------
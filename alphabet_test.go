@@ -0,0 +1,68 @@
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	for _, tc := range []struct {
+		alphabet Alphabet
+		in, out  string
+	}{
+		{Alphabet{FoldCase: true, Ambiguous: AmbiguousToN}, "acgtRYnNxx|$", "ACGTNNNNXX|$"},
+		{Alphabet{Ambiguous: AmbiguousToN}, "acgtRynN", "acgtNnnN"},
+	} {
+		s := []byte(tc.in)
+		tc.alphabet.normalizer(false).apply(s)
+		if string(s) != tc.out {
+			t.Errorf("%v: %q became %q instead of %q", tc.alphabet, tc.in, s, tc.out)
+		}
+		if a, err := parseAlphabet(tc.alphabet.String()); err != nil || a != tc.alphabet {
+			t.Errorf("%v was parsed as %v, %v", tc.alphabet, a, err)
+		}
+	}
+}
+
+func TestSearchNormalizesQueries(t *testing.T) {
+	alphabet := Alphabet{FoldCase: true, Ambiguous: AmbiguousToN}
+	b := NewIndexBuilder(BuildOptions{Multiple: true, CompressionRatio: 4, Alphabet: alphabet})
+	b.AddReader("mem", strings.NewReader(">a\nACGTTGCAACGTGGATCCAT\n>b\nggGACTACGTTTAGC\n"))
+	I, err := b.Build(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := I.C['g']; ok {
+		t.Fatal("the index has lowercase symbols")
+	}
+	sp, ep := I.Search([]byte("gggact"))
+	if ep != sp {
+		t.Fatalf("gggact matches rows %d to %d", sp, ep)
+	}
+	// The text has no N, and X is not a symbol of the alphabet.
+	for _, query := range []string{"ACGX", "X", "GGATNC", "N"} {
+		if sp, ep := I.Search([]byte(query)); sp <= ep {
+			t.Errorf("%s matches rows %d to %d", query, sp, ep)
+		}
+	}
+	if out := I.FindGenomeD([]byte("GGGACTNCGTTTAGC"), []byte("GGGACTNCGT"), 100); len(out) > 1 {
+		t.Errorf("reads with N were found in %v", out)
+	}
+
+	var buf bytes.Buffer
+	if _, err := I.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	J, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if J.ALPHABET != alphabet {
+		t.Fatalf("the alphabet was read as %v", J.ALPHABET)
+	}
+	if sp2, ep2 := J.Search([]byte("gggact")); sp2 != sp || ep2 != ep {
+		t.Errorf("the read index matches rows %d to %d instead of %d to %d", sp2, ep2, sp, ep)
+	}
+}
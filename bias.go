@@ -0,0 +1,449 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Bias correction of effective lengths: sequence-specific bias at the ends
+	of fragments, fragment GC bias and positional bias.
+*/
+package fmic
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Which bias models correct the effective lengths.
+type BiasOptions struct {
+	Sequence   bool // bases around the 5' and 3' ends of fragments
+	GC         bool // GC content of fragments
+	Positional bool // where fragments start along their sequence
+}
+
+const (
+	bias_flank         = 3              // bases on each side of a fragment end
+	bias_context       = 2 * bias_flank // bases in the context of a fragment end
+	gc_bins            = 25
+	position_bins      = 20
+	num_length_classes = 5
+	bias_weight_min    = 0.01
+	bias_weight_max    = 100
+)
+
+// Upper bounds of the lengths of all but the last class of the positional
+// model; sequences of different lengths are biased differently.
+var length_class_bounds = [num_length_classes - 1]indexType{800, 1300, 1700, 2400}
+
+//-----------------------------------------------------------------------------
+// The fragments seen by Quant, counted by feature, to learn the bias models.
+// The context of the 5' end of a fragment is the bias_flank bases before it
+// and the bias_flank bases from it.  That of the 3' end is the same on the
+// reverse strand.  Bases are indexed A, C, G, T.
+//-----------------------------------------------------------------------------
+type BiasCounts struct {
+	Fragments int64
+	Start     [bias_context][4]int64
+	End       [bias_context][4]int64
+	GC        [gc_bins]int64
+	Position  [num_length_classes][position_bins]int64
+}
+
+//-----------------------------------------------------------------------------
+// The learned models.  Each holds the frequencies of its features among the
+// observed fragments and among the fragments expected without bias; the
+// weight of a feature is their ratio.  Fragments of FragmentLength are
+// expected at each position in proportion to the abundance of the sequence.
+//-----------------------------------------------------------------------------
+type BiasModel struct {
+	Options        BiasOptions
+	FragmentLength int
+	Fragments      int64 // observed fragments
+
+	ObservedStart, ExpectedStart       [bias_context][4]float64
+	ObservedEnd, ExpectedEnd           [bias_context][4]float64
+	ObservedGC, ExpectedGC             [gc_bins]float64
+	ObservedPosition, ExpectedPosition [num_length_classes][position_bins]float64
+
+	EffLength []float64 // corrected effective lengths of the targets
+}
+
+//-----------------------------------------------------------------------------
+func (opt BiasOptions) any() bool {
+	return opt.Sequence || opt.GC || opt.Positional
+}
+
+//-----------------------------------------------------------------------------
+func (b *BiasCounts) merge(other *BiasCounts) {
+	b.Fragments += other.Fragments
+	for j := range b.Start {
+		for c := range b.Start[j] {
+			b.Start[j][c] += other.Start[j][c]
+			b.End[j][c] += other.End[j][c]
+		}
+	}
+	for i := range b.GC {
+		b.GC[i] += other.GC[i]
+	}
+	for l := range b.Position {
+		for i := range b.Position[l] {
+			b.Position[l][i] += other.Position[l][i]
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Count the fragment [start, end) of sequence k.
+//-----------------------------------------------------------------------------
+func (b *BiasCounts) add(I *IndexC, k int, start, end indexType) {
+	length := I.LENS[k]
+	lo, hi := start-bias_flank, end+bias_flank
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > length {
+		hi = length
+	}
+	s := I.Extract(k, lo, hi)
+	b.Fragments++
+	if ctx, ok := fragmentContext(s, lo, start, false); ok {
+		for j, c := range ctx {
+			b.Start[j][c]++
+		}
+	}
+	if ctx, ok := fragmentContext(s, lo, end, true); ok {
+		for j, c := range ctx {
+			b.End[j][c]++
+		}
+	}
+	b.GC[gcBin(gcCount(s[start-lo:end-lo]), end-start)]++
+	b.Position[lengthClass(length)][positionBin(start, length)]++
+}
+
+//-----------------------------------------------------------------------------
+// 0, 1, 2, 3 for A, C, G, T in either case, and -1 for other symbols.
+//-----------------------------------------------------------------------------
+func baseIndex(c byte) int {
+	switch c {
+	case 'A', 'a':
+		return 0
+	case 'C', 'c':
+		return 1
+	case 'G', 'g':
+		return 2
+	case 'T', 't':
+		return 3
+	}
+	return -1
+}
+
+//-----------------------------------------------------------------------------
+// The context of the fragment end at position x of a sequence, of which s
+// holds the positions from lo.  On the reverse strand, the context is read
+// backwards and complemented.  It is not ok if it is not all in s or is not
+// all bases.
+//-----------------------------------------------------------------------------
+func fragmentContext(s []byte, lo, x indexType, reverse bool) ([bias_context]int, bool) {
+	var ctx [bias_context]int
+	for j := range ctx {
+		p := x - bias_flank + indexType(j)
+		if reverse {
+			p = x + bias_flank - 1 - indexType(j)
+		}
+		if p < lo || p-lo >= indexType(len(s)) {
+			return ctx, false
+		}
+		c := baseIndex(s[p-lo])
+		if c < 0 {
+			return ctx, false
+		}
+		if reverse {
+			c = 3 - c
+		}
+		ctx[j] = c
+	}
+	return ctx, true
+}
+
+//-----------------------------------------------------------------------------
+func gcCount(s []byte) indexType {
+	var n indexType
+	for _, c := range s {
+		if c == 'G' || c == 'C' || c == 'g' || c == 'c' {
+			n++
+		}
+	}
+	return n
+}
+
+func gcBin(gc, length indexType) int {
+	return int(math.Round(float64(gc) / float64(length) * (gc_bins - 1)))
+}
+
+func positionBin(start, length indexType) int {
+	return int(start * position_bins / length)
+}
+
+func lengthClass(length indexType) int {
+	for l, bound := range length_class_bounds {
+		if length <= bound {
+			return l
+		}
+	}
+	return num_length_classes - 1
+}
+
+//-----------------------------------------------------------------------------
+// Where read starts in sequence k, found by extending its seed until it has
+// a single hit.  It is not ok if that hit is not in k or the read does not
+// fit in k.
+//-----------------------------------------------------------------------------
+func (I *IndexC) readStart(k int, read []byte) (indexType, bool) {
+	query := I.normalizeQuery(read)
+	start_pos := I.seedStart(query)
+	if start_pos >= len(query) {
+		return 0, false
+	}
+	c := query[start_pos]
+	sp, ok := I.C[c]
+	if !ok || I.ALPHABET.SplitAtN && isN(c) {
+		return 0, false
+	}
+	ep := I.EP[c]
+	i := start_pos + 1
+	for ; sp < ep && i < len(query); i++ {
+		c = query[i]
+		offset, ok := I.C[c]
+		if !ok || I.ALPHABET.SplitAtN && isN(c) {
+			return 0, false
+		}
+		sp = offset + I.Occurence(c, sp-1)
+		ep = offset + I.Occurence(c, ep) - 1
+	}
+	if sp != ep || I.SequenceOf(sp) != k {
+		return 0, false
+	}
+	// query[start_pos:i] ends at position LEN-2-Locate(sp) of the text.
+	x := I.LEN - 2 - I.Locate(sp) - I.offsets[k] - indexType(i-1)
+	if x < 0 || x+indexType(len(query)) > I.LENS[k] {
+		return 0, false
+	}
+	return x, true
+}
+
+//-----------------------------------------------------------------------------
+// The fragment of a pair assigned to sequence k: from the first start of its
+// reads to the last end.
+//-----------------------------------------------------------------------------
+func (I *IndexC) fragmentOf(k int, p ReadPair) (indexType, indexType, bool) {
+	x1, ok1 := I.readStart(k, p.Read1)
+	x2, ok2 := I.readStart(k, p.Read2)
+	if !ok1 || !ok2 {
+		return 0, 0, false
+	}
+	start, end := x1, x1+indexType(len(p.Read1))
+	if x2 < start {
+		start = x2
+	}
+	if e := x2 + indexType(len(p.Read2)); e > end {
+		end = e
+	}
+	return start, end, true
+}
+
+//-----------------------------------------------------------------------------
+// Learn the bias models of opt from the fragments in obs, and compute the
+// effective lengths they imply.  A, from an uncorrected estimate, weighs the
+// expected fragments.  The sequences come from SEQ or are extracted from the
+// BWT, which needs a sampled ISA.
+//-----------------------------------------------------------------------------
+func (I *IndexC) LearnBias(obs *BiasCounts, A *Abundance, opt BiasOptions, fragment_length float64) (*BiasModel, error) {
+	if obs == nil || obs.Fragments == 0 {
+		return nil, errors.New("LearnBias: no fragments to learn from")
+	}
+	if len(I.SEQ) == 0 && I.ISA_RATE <= 0 {
+		return nil, errors.New("LearnBias: index has neither SEQ nor a sampled ISA")
+	}
+	m := &BiasModel{Options: opt, Fragments: obs.Fragments, FragmentLength: int(math.Round(fragment_length))}
+	if m.FragmentLength < 1 {
+		m.FragmentLength = 1
+	}
+	fl := indexType(m.FragmentLength)
+	n := len(A.IDs)
+
+	// The expected fragments.
+	var exp_start, exp_end [bias_context][4]float64
+	var exp_gc [gc_bins]float64
+	var exp_position [num_length_classes][position_bins]float64
+	for k := 0; k < n; k++ {
+		length := I.LENS[k]
+		a := A.NumReads[k] / A.EffLength[k]
+		if a <= 0 || length < fl {
+			continue
+		}
+		s := I.Extract(k, 0, length)
+		class := lengthClass(length)
+		gc := gcCount(s[:fl])
+		for x := indexType(0); x+fl <= length; x++ {
+			if x > 0 {
+				gc += gcCount(s[x+fl-1:x+fl]) - gcCount(s[x-1:x])
+			}
+			if ctx, ok := fragmentContext(s, 0, x, false); ok {
+				for j, c := range ctx {
+					exp_start[j][c] += a
+				}
+			}
+			if ctx, ok := fragmentContext(s, 0, x+fl, true); ok {
+				for j, c := range ctx {
+					exp_end[j][c] += a
+				}
+			}
+			exp_gc[gcBin(gc, fl)] += a
+			exp_position[class][positionBin(x, length)] += a
+		}
+	}
+
+	// Frequencies, with a pseudocount of one observed fragment.
+	for j := 0; j < bias_context; j++ {
+		m.ObservedStart[j], m.ExpectedStart[j] = frequencies4(obs.Start[j], exp_start[j])
+		m.ObservedEnd[j], m.ExpectedEnd[j] = frequencies4(obs.End[j], exp_end[j])
+	}
+	observed, expected := frequencies(obs.GC[:], exp_gc[:])
+	copy(m.ObservedGC[:], observed)
+	copy(m.ExpectedGC[:], expected)
+	for l := 0; l < num_length_classes; l++ {
+		observed, expected = frequencies(obs.Position[l][:], exp_position[l][:])
+		copy(m.ObservedPosition[l][:], observed)
+		copy(m.ExpectedPosition[l][:], expected)
+	}
+
+	// The effective length of a sequence is the sum of the weights of the
+	// fragments that can start in it.
+	m.EffLength = make([]float64, n)
+	for k := 0; k < n; k++ {
+		length := I.LENS[k]
+		if length < fl || !opt.any() {
+			m.EffLength[k] = math.Max(float64(length-fl+1), 1)
+			continue
+		}
+		s := I.Extract(k, 0, length)
+		class := lengthClass(length)
+		gc := gcCount(s[:fl])
+		sum := 0.0
+		for x := indexType(0); x+fl <= length; x++ {
+			if x > 0 {
+				gc += gcCount(s[x+fl-1:x+fl]) - gcCount(s[x-1:x])
+			}
+			w := 1.0
+			if opt.Sequence {
+				if ctx, ok := fragmentContext(s, 0, x, false); ok {
+					w *= m.contextWeight(ctx, &m.ObservedStart, &m.ExpectedStart)
+				}
+				if ctx, ok := fragmentContext(s, 0, x+fl, true); ok {
+					w *= m.contextWeight(ctx, &m.ObservedEnd, &m.ExpectedEnd)
+				}
+			}
+			if opt.GC {
+				b := gcBin(gc, fl)
+				w *= biasWeight(m.ObservedGC[b], m.ExpectedGC[b])
+			}
+			if opt.Positional {
+				b := positionBin(x, length)
+				w *= biasWeight(m.ObservedPosition[class][b], m.ExpectedPosition[class][b])
+			}
+			sum += w
+		}
+		m.EffLength[k] = math.Max(sum, 1)
+	}
+	return m, nil
+}
+
+//-----------------------------------------------------------------------------
+func (m *BiasModel) contextWeight(ctx [bias_context]int, observed, expected *[bias_context][4]float64) float64 {
+	w := 1.0
+	for j, c := range ctx {
+		w *= biasWeight(observed[j][c], expected[j][c])
+	}
+	return w
+}
+
+func biasWeight(observed, expected float64) float64 {
+	return math.Min(math.Max(observed/expected, bias_weight_min), bias_weight_max)
+}
+
+//-----------------------------------------------------------------------------
+// Normalize the observed counts and expected weights of a feature to sum to
+// 1, each with a pseudocount worth one observed fragment.
+//-----------------------------------------------------------------------------
+func frequencies(observed []int64, expected []float64) ([]float64, []float64) {
+	total_obs, total_exp := 0.0, 0.0
+	for i := range observed {
+		total_obs += float64(observed[i])
+		total_exp += expected[i]
+	}
+	pseudo := 1.0
+	if total_obs > 0 {
+		pseudo = total_exp / total_obs
+	}
+	if pseudo <= 0 {
+		pseudo = 1
+	}
+	n := float64(len(observed))
+	obs, exp := make([]float64, len(observed)), make([]float64, len(expected))
+	for i := range observed {
+		obs[i] = (float64(observed[i]) + 1) / (total_obs + n)
+		exp[i] = (expected[i] + pseudo) / (total_exp + pseudo*n)
+	}
+	return obs, exp
+}
+
+func frequencies4(observed [4]int64, expected [4]float64) ([4]float64, [4]float64) {
+	var obs, exp [4]float64
+	o, e := frequencies(observed[:], expected[:])
+	copy(obs[:], o)
+	copy(exp[:], e)
+	return obs, exp
+}
+
+//-----------------------------------------------------------------------------
+// Write the models that are used, for quality control, as lines
+// "model feature observed expected weight".  Context features are the
+// offset from the fragment end and the base; GC features are the fraction of
+// GC; positional features are the length class and the relative start.
+//-----------------------------------------------------------------------------
+func (m *BiasModel) WriteTSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# fragments=%d fragment_length=%d\n", m.Fragments, m.FragmentLength)
+	fmt.Fprintf(bw, "Model\tFeature\tObserved\tExpected\tWeight\n")
+	line := func(model, feature string, observed, expected float64) {
+		fmt.Fprintf(bw, "%s\t%s\t%.6f\t%.6f\t%.4f\n", model, feature, observed, expected, biasWeight(observed, expected))
+	}
+	if m.Options.Sequence {
+		for j := 0; j < bias_context; j++ {
+			for c := 0; c < 4; c++ {
+				feature := fmt.Sprintf("%+d:%c", j-bias_flank, "ACGT"[c])
+				line("start", feature, m.ObservedStart[j][c], m.ExpectedStart[j][c])
+				line("end", feature, m.ObservedEnd[j][c], m.ExpectedEnd[j][c])
+			}
+		}
+	}
+	if m.Options.GC {
+		for i := 0; i < gc_bins; i++ {
+			line("gc", fmt.Sprintf("%.2f", float64(i)/(gc_bins-1)), m.ObservedGC[i], m.ExpectedGC[i])
+		}
+	}
+	if m.Options.Positional {
+		for l := 0; l < num_length_classes; l++ {
+			class := fmt.Sprintf(">%d", length_class_bounds[num_length_classes-2])
+			if l < num_length_classes-1 {
+				class = fmt.Sprintf("<=%d", length_class_bounds[l])
+			}
+			for i := 0; i < position_bins; i++ {
+				feature := fmt.Sprintf("%s:%.2f", class, float64(i)/position_bins)
+				line("position", feature, m.ObservedPosition[l][i], m.ExpectedPosition[l][i])
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,78 @@
+package fmic
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// Fragments of length 150 that start at a G three times out of four.
+func gStartFragments(r *rand.Rand, recs []string, n int) []fragment {
+	var frags []fragment
+	for len(frags) < n {
+		k := r.Intn(len(recs))
+		s := r.Intn(len(recs[k]) - 150)
+		if recs[k][s] == 'G' || r.Intn(4) == 0 {
+			frags = append(frags, fragment{k, s, s + 150})
+		}
+	}
+	return frags
+}
+
+func TestLearnBias(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	recs := []string{randSeq(r, 900), randSeq(r, 1500), randSeq(r, 600)}
+	I := buildIndex(t, writeFasta(t, recs), BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 8})
+	frags := gStartFragments(r, recs, 3000)
+	for _, f := range frags[:50] {
+		p := ReadPair{[]byte(recs[f.k][f.start : f.start+50]), []byte(recs[f.k][f.end-50 : f.end])}
+		if a, b, ok := I.fragmentOf(f.k, p); ok && (a != indexType(f.start) || b != indexType(f.end)) {
+			t.Fatalf("fragment %v was found at [%d, %d)", f, a, b)
+		}
+	}
+	r1, r2 := writePairs(recs, frags, 50)
+	E := I.QuantReader(r1, r2, QuantOptions{Workers: 3, MaxInsert: 500, Bias: true})
+	if E.Bias == nil || E.Bias.Fragments < int64(len(frags)*9/10) {
+		t.Fatalf("bias counts %+v", E.Bias)
+	}
+	A := I.EstimateAbundance(E, EMOptions{FragmentLength: 150, Bias: BiasOptions{true, true, true}})
+	m := A.Bias
+	if m == nil {
+		t.Fatal("no bias model")
+	}
+	if w := biasWeight(m.ObservedStart[bias_flank][2], m.ExpectedStart[bias_flank][2]); w < 2 {
+		t.Errorf("fragments start at G with weight %g", w)
+	}
+	var out bytes.Buffer
+	if err := m.WriteTSV(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without SEQ, the model is learned through the sampled ISA.
+	seq := I.SEQ
+	I.SEQ = nil
+	B := I.EstimateAbundance(E, EMOptions{FragmentLength: 150, Bias: BiasOptions{true, true, true}})
+	I.SEQ = seq
+	if !reflect.DeepEqual(A.EffLength, B.EffLength) {
+		t.Errorf("effective lengths %v with SEQ, %v with ISA", A.EffLength, B.EffLength)
+	}
+}
+
+func TestBiasWithoutUniqueFragments(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	rec := randSeq(r, 1000)
+	recs := []string{rec, rec}
+	I := buildIndex(t, writeFasta(t, recs), BuildOptions{Multiple: true, CompressionRatio: 4})
+	r1, r2 := writePairs(recs, gStartFragments(r, recs, 200), 50)
+	for _, E := range []*EqCounts{
+		I.QuantReader(r1, r2, QuantOptions{MaxInsert: 500, Bias: true}),
+		I.QuantReader(&bytes.Buffer{}, &bytes.Buffer{}, QuantOptions{Bias: true}),
+	} {
+		A := I.EstimateAbundance(E, EMOptions{FragmentLength: 150})
+		B := I.EstimateAbundance(E, EMOptions{FragmentLength: 150, Bias: BiasOptions{Sequence: true}})
+		if B.Bias != nil || !reflect.DeepEqual(A.EffLength, B.EffLength) {
+			t.Errorf("%d fragments: bias model %v, effective lengths %v instead of %v", E.Bias.Fragments, B.Bias, B.EffLength, A.EffLength)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Bit vectors with rank support.
+*/
+package fmic
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+)
+
+// Number of 64-bit words between two stored ranks.
+const rank_words = 8
+
+//-----------------------------------------------------------------------------
+// BitVector is an array of bits.  Once buildRanks is called, Rank counts the
+// set bits before any position in constant time.
+//-----------------------------------------------------------------------------
+type BitVector struct {
+	N     indexType
+	words []uint64
+	ranks []indexType // ranks[k] is the number of set bits in words[:k*rank_words]
+}
+
+//-----------------------------------------------------------------------------
+func NewBitVector(n indexType) BitVector {
+	return BitVector{N: n, words: make([]uint64, (n+63)/64)}
+}
+
+//-----------------------------------------------------------------------------
+func (b BitVector) Set(i indexType) {
+	b.words[i/64] |= 1 << uint(i%64)
+}
+
+//-----------------------------------------------------------------------------
+func (b BitVector) Get(i indexType) bool {
+	return b.words[i/64]&(1<<uint(i%64)) != 0
+}
+
+//-----------------------------------------------------------------------------
+func (b *BitVector) buildRanks() {
+	b.ranks = make([]indexType, len(b.words)/rank_words+1)
+	var r indexType
+	for k, w := range b.words {
+		if k%rank_words == 0 {
+			b.ranks[k/rank_words] = r
+		}
+		r += indexType(bits.OnesCount64(w))
+	}
+	if len(b.words)%rank_words == 0 {
+		b.ranks[len(b.ranks)-1] = r
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Number of set bits in positions [0, i).
+//-----------------------------------------------------------------------------
+func (b BitVector) Rank(i indexType) indexType {
+	k := i / 64
+	r := b.ranks[k/rank_words]
+	for j := k / rank_words * rank_words; j < k; j++ {
+		r += indexType(bits.OnesCount64(b.words[j]))
+	}
+	if i%64 > 0 {
+		r += indexType(bits.OnesCount64(b.words[k] << uint(64-i%64)))
+	}
+	return r
+}
+
+//-----------------------------------------------------------------------------
+// Write the words in little endian.
+//-----------------------------------------------------------------------------
+func (b BitVector) write(w io.Writer) error {
+	for i := 0; i < len(b.words); i += ints_chunk {
+		j := i + ints_chunk
+		if j > len(b.words) {
+			j = len(b.words)
+		}
+		if err := binary.Write(w, binary.LittleEndian, b.words[i:j]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Read a vector of n bits written by write, and build its ranks.
+//-----------------------------------------------------------------------------
+func readBitVector(r io.Reader, n indexType) (BitVector, error) {
+	b := NewBitVector(n)
+	for i := 0; i < len(b.words); i += ints_chunk {
+		j := i + ints_chunk
+		if j > len(b.words) {
+			j = len(b.words)
+		}
+		if err := binary.Read(r, binary.LittleEndian, b.words[i:j]); err != nil {
+			return b, err
+		}
+	}
+	b.buildRanks()
+	return b, nil
+}
+
+//-----------------------------------------------------------------------------
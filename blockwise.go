@@ -0,0 +1,290 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Suffix sorting in blocks that fit a memory budget.
+*/
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// Bytes per suffix of a block: its rank, its symbol and its row in SA-IS.
+const block_bytes_per_suffix = 24
+
+// Rows between two stored counts of bwtRanks.
+const rank_step = 256
+
+//-----------------------------------------------------------------------------
+// Split SEQ into blocks of at most memory_budget bytes of work, and merge
+// them into the BWT from the last block to the first: the suffixes of each
+// block are ranked among the suffixes merged so far by backward search,
+// sorted among themselves with SA-IS, and inserted in the BWT.  Then a walk
+// of the text through the BWT fills SA, SSA and ISA.  Besides the text and
+// the arrays of the index, this takes the memory budget and about 1/32 byte
+// per symbol of the text and per distinct symbol, plus the positions of the
+// samples while SA is sampled.
+//
+// Inserting a block rewrites the rows merged so far and recounts their
+// ranks, so a text of n symbols in blocks of b suffixes takes O(n*n/b)
+// time: halving the budget doubles the time of the merge.
+//-----------------------------------------------------------------------------
+func (I *IndexC) sortBlockwise(ctx context.Context, progress Progress, rows *rowBuilder) error {
+	n := int(I.LEN)
+	block_size := int(I.memory_budget / block_bytes_per_suffix)
+	if block_size < 1 {
+		block_size = 1
+	}
+	num_blocks := (n + block_size - 1) / block_size
+
+	m := &bwtMerger{text: I.SEQ, bwt: I.BWT, start: n}
+	for _, c := range I.SEQ {
+		m.symbols[c]++
+	}
+	work := block_size + 1
+	if work > n+1 {
+		work = n + 1
+	}
+	m.rank, m.Z, m.SA = make([]int, work), make([]int, work), make([]int, work)
+	for k := num_blocks - 1; k >= 0; k-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress.Phase(fmt.Sprintf("%s: merge block %d of %d", PhaseSuffixArray, num_blocks-k, num_blocks))
+		if err := m.add(ctx, k*block_size); err != nil {
+			return err
+		}
+	}
+	for c, f := range m.symbols {
+		if f > 0 {
+			I.Freq[byte(c)] = indexType(f)
+		}
+	}
+	// The suffix at 0 is preceded by the final '$'.
+	I.END_POS = indexType(m.row)
+
+	progress.Phase(PhaseBWT)
+	return I.fillRows(ctx, m, rows)
+}
+
+//-----------------------------------------------------------------------------
+// Walk the text backwards from its first suffix with LF, and fill SA, SSA
+// and ISA at the row of each position.
+//-----------------------------------------------------------------------------
+func (I *IndexC) fillRows(ctx context.Context, m *bwtMerger, rows *rowBuilder) error {
+	var C [256]int
+	for c, sum := 1, 0; c < 256; c++ {
+		sum += m.counts[c-1]
+		C[c] = sum
+	}
+	// Rows are visited out of order, so sampled[k] keeps the row of position
+	// k*SA_RATE until SA_MARK can rank it.
+	var sampled Ints
+	if I.SA_RATE > 0 {
+		sampled = NewInts(I.IDX_WIDTH, I.SA.Len())
+	}
+	fill := func(p indexType, row int) {
+		i := indexType(row)
+		switch {
+		case I.NO_SA:
+		case I.SA_RATE == 0:
+			I.SA.Set(i, p)
+		case p%I.SA_RATE == 0:
+			I.SA_MARK.Set(i)
+			sampled.Set(p/I.SA_RATE, i)
+		}
+		if I.SSA.Len() > 0 {
+			I.SSA.Set(i, rows.sequence(p))
+		}
+		if d := I.LEN - 1 - p; I.ISA_RATE > 0 && d%I.ISA_RATE == 0 {
+			I.ISA.Set(d/I.ISA_RATE, i)
+		}
+	}
+	row := m.row
+	fill(0, row)
+	for p := I.LEN - 1; p > 0; p-- {
+		if p%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c := m.bwt[row]
+		row = C[c] + m.ranks.rank(c, row)
+		fill(p, row)
+	}
+	if I.SA_RATE > 0 {
+		I.SA_MARK.buildRanks()
+		for k := indexType(0); k < sampled.Len(); k++ {
+			I.SA.Set(I.SA_MARK.Rank(sampled.Get(k)), k*I.SA_RATE)
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// bwtMerger holds the BWT of the suffixes of text that start at start or
+// after, in the end of bwt.  The row of the suffix at start holds the symbol
+// before it, although that symbol is not in the suffixes yet.
+//-----------------------------------------------------------------------------
+type bwtMerger struct {
+	text    []byte
+	bwt     []byte
+	start   int
+	row     int      // row of the suffix at start
+	counts  [256]int // symbols of text[start:]
+	symbols [256]int // symbols of text
+	ranks   bwtRanks // of the merged rows
+
+	// Work space of a block, kept for the next.
+	rank, Z, SA []int
+}
+
+//-----------------------------------------------------------------------------
+// Merge the suffixes that start in [s, m.start).
+//-----------------------------------------------------------------------------
+func (m *bwtMerger) add(ctx context.Context, s int) error {
+	text, e := m.text, m.start
+	b, size := e-s, len(text)-e
+	rank, Z, SA := m.rank[:b], m.Z[:b+1], m.SA[:b+1]
+
+	// rank[j] is the number of merged suffixes smaller than the suffix at s+j.
+	var C [256]int
+	for c, sum := 1, 0; c < 256; c++ {
+		sum += m.counts[c-1]
+		C[c] = sum
+	}
+	for j, r := b-1, m.row; j >= 0; j-- {
+		if j%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if size > 0 {
+			c := text[s+j]
+			r = C[c] + m.occ(c, r)
+		}
+		rank[j] = r
+	}
+
+	// Sort the suffixes of the block.  A suffix is renamed by its symbol, and
+	// by whether it is larger than the suffix at e, which the symbol after
+	// the block stands for: two suffixes whose symbols agree up to the end of
+	// the block then compare as the suffixes of the text do.
+	if size == 0 {
+		for j := 0; j < b; j++ {
+			Z[j] = int(text[s+j])
+		}
+		computeSuffixArrayInt(Z[:b], 256, SA[:b])
+	} else {
+		for j := 0; j < b; j++ {
+			Z[j] = 3 * int(text[s+j])
+			if rank[j] > m.row {
+				Z[j] += 2
+			}
+		}
+		Z[b] = 3*int(text[e]) + 1
+		computeSuffixArrayInt(Z, 3*256, SA)
+		k := 0
+		for _, j := range SA {
+			if j < b {
+				SA[k] = j
+				k++
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Insert the suffixes of the block before the rows of their ranks.  The
+	// rows move to the front of bwt, so each is read before it is written.
+	from, to := len(m.bwt)-size, len(m.bwt)-size-b
+	i, k := 0, 0
+	for row := 0; row <= size; row++ {
+		for ; k < b && rank[SA[k]] == row; k++ {
+			p := s + SA[k]
+			if p == s {
+				m.row = i
+			}
+			if p == 0 {
+				m.bwt[to+i] = text[len(text)-1]
+			} else {
+				m.bwt[to+i] = text[p-1]
+			}
+			i++
+		}
+		if row < size {
+			m.bwt[to+i] = m.bwt[from+row]
+			i++
+		}
+	}
+	if k < b {
+		panic("bwtMerger: the suffixes of a block are not sorted by rank")
+	}
+	m.start = s
+	for _, c := range text[s:e] {
+		m.counts[c]++
+	}
+	m.ranks.build(m.bwt[to:], &m.symbols)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Number of merged suffixes in the rows before r that are preceded by c.
+//-----------------------------------------------------------------------------
+func (m *bwtMerger) occ(c byte, r int) int {
+	count := m.ranks.rank(c, r)
+	if r > m.row && c == m.text[m.start-1] {
+		count-- // the symbol before the suffix at start
+	}
+	return count
+}
+
+//-----------------------------------------------------------------------------
+// bwtRanks counts the symbols of a BWT before every rank_step-th row.
+//-----------------------------------------------------------------------------
+type bwtRanks struct {
+	bwt     []byte
+	symbols []byte   // the symbols that may be in bwt
+	column  [256]int // column of each symbol in counts; -1 if it is absent
+	counts  []int    // counts[k*len(symbols)+column[c]] is the number of c in bwt[:k*rank_step]
+}
+
+func (r *bwtRanks) build(bwt []byte, symbols *[256]int) {
+	r.bwt, r.symbols = bwt, r.symbols[:0]
+	for c := range r.column {
+		r.column[c] = -1
+		if symbols[c] > 0 {
+			r.column[c] = len(r.symbols)
+			r.symbols = append(r.symbols, byte(c))
+		}
+	}
+	width := len(r.symbols)
+	size := (len(bwt)/rank_step + 1) * width
+	if cap(r.counts) < size {
+		r.counts = make([]int, size)
+	}
+	r.counts = r.counts[:size]
+	var count [256]int
+	for k := 0; k*rank_step <= len(bwt); k++ {
+		for col, c := range r.symbols {
+			r.counts[k*width+col] = count[c]
+		}
+		end := (k + 1) * rank_step
+		if end > len(bwt) {
+			end = len(bwt)
+		}
+		for _, c := range bwt[k*rank_step : end] {
+			count[c]++
+		}
+	}
+}
+
+// Number of c in bwt[:i].
+func (r *bwtRanks) rank(c byte, i int) int {
+	col := r.column[c]
+	if col < 0 {
+		return 0
+	}
+	k := i / rank_step
+	return r.counts[k*len(r.symbols)+col] + bytes.Count(r.bwt[k*rank_step:i], []byte{c})
+}
+
+//-----------------------------------------------------------------------------
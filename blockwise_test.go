@@ -0,0 +1,36 @@
+package fmic
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestBuildWithMemoryBudget(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	unit := randSeq(r, 300)
+	recs := []string{unit, strings.Repeat("N", 4000), unit + unit, randSeq(r, 1), strings.Repeat("A", 500), randSeq(r, 2000), strings.Repeat("AC", 300)}
+	file := writeFasta(t, recs)
+	for _, width := range []int{4, 8} {
+		for _, opt := range []BuildOptions{
+			{Multiple: true},
+			{Multiple: true, ISARate: 4},
+			{Multiple: true, NoSSA: true, SARate: 1, ISARate: 3},
+			{Multiple: true, SARate: 7, ISARate: 1},
+			{Multiple: true, NoSSA: true, SARate: 32},
+		} {
+			opt.CompressionRatio, opt.IndexWidth = 4, width
+			I := buildIndex(t, file, opt)
+			for _, budget := range []int64{1, 100, 1000, 1 << 20} {
+				opt.MemoryBudget = budget
+				J := buildIndex(t, file, opt)
+				sameIndex(t, I, J)
+				for i := indexType(0); i < J.LEN; i += 17 {
+					if J.Locate(i) != I.Locate(i) {
+						t.Fatalf("budget %d: row %d at %d instead of %d", budget, i, J.Locate(i), I.Locate(i))
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Index construction from several fasta sources.
+*/
+package fmic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+// IndexBuilder builds one index from the records of several fasta files or
+// readers, in the order they are added.  Sequence ids must be unique across
+// all of them.
+//-----------------------------------------------------------------------------
+type IndexBuilder struct {
+	opt     BuildOptions
+	sources []fastaSource
+	output  string
+}
+
+type fastaSource struct {
+	name string
+	r    io.Reader // nil to open the file called name
+}
+
+//-----------------------------------------------------------------------------
+func NewIndexBuilder(opt BuildOptions) *IndexBuilder {
+	return &IndexBuilder{opt: opt}
+}
+
+//-----------------------------------------------------------------------------
+// Add fasta files, which may be compressed (see readFastaRecords).
+//-----------------------------------------------------------------------------
+func (b *IndexBuilder) AddFile(files ...string) {
+	for _, file := range files {
+		b.sources = append(b.sources, fastaSource{name: file})
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Add fasta records read from r; name is used in errors.
+//-----------------------------------------------------------------------------
+func (b *IndexBuilder) AddReader(name string, r io.Reader) {
+	b.sources = append(b.sources, fastaSource{name: name, r: r})
+}
+
+//-----------------------------------------------------------------------------
+// Set the directory that SaveCompressedIndex writes to.  By default, it is
+// the first file added, followed by ".fmi".
+//-----------------------------------------------------------------------------
+func (b *IndexBuilder) SetOutput(dir string) {
+	b.output = dir
+}
+
+//-----------------------------------------------------------------------------
+// Read all sources and build the index, reporting the bytes read over all of
+// them to progress.
+//-----------------------------------------------------------------------------
+func (b *IndexBuilder) Build(ctx context.Context, progress Progress) (*IndexC, error) {
+	progress = orNoProgress(progress)
+	if len(b.sources) == 0 {
+		return nil, errors.New("IndexBuilder: no fasta sources")
+	}
+	input_file := ""
+	for _, src := range b.sources {
+		if src.r == nil {
+			input_file = src.name
+			break
+		}
+	}
+	I, err := newIndex(input_file, b.opt)
+	if err != nil {
+		return nil, err
+	}
+	I.save_dir = b.output
+
+	progress.Phase(PhaseReadFasta)
+	text := &textBuilder{I: I}
+	source := make(map[string]string) // the source of each id
+	var read int64
+	for _, src := range b.sources {
+		src := src
+		add := func(id, des string, seq []byte) error {
+			if prev, ok := source[id]; ok {
+				return fmt.Errorf("IndexBuilder: id %s of %s is also in %s", id, src.name, prev)
+			}
+			source[id] = src.name
+			return text.add(id, des, seq)
+		}
+		base := read
+		bytesRead := func(n int64) {
+			read = base + n
+			progress.BytesRead(read)
+		}
+		if src.r != nil {
+			err = readFastaFrom(ctx, src.name, src.r, bytesRead, add)
+		} else {
+			var f *os.File
+			if f, err = os.Open(src.name); err == nil {
+				err = readFastaFrom(ctx, src.name, f, bytesRead, add)
+				f.Close()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	text.finish()
+
+	if err = I.build(ctx, progress); err != nil {
+		return nil, err
+	}
+	return I, nil
+}
+
+//-----------------------------------------------------------------------------
+// textBuilder concatenates records into I.SEQ, the way ReadFasta does:
+// separated by '|', reversed, and terminated by '$'.
+//-----------------------------------------------------------------------------
+type textBuilder struct {
+	I    *IndexC
+	text []byte
+}
+
+func (t *textBuilder) add(id, des string, seq []byte) error {
+	I := t.I
+	if err := I.checkNumSequences(len(I.GENOME_ID) + 1); err != nil {
+		return err
+	}
+	I.GENOME_ID = append(I.GENOME_ID, id)
+	I.GENOME_DES = append(I.GENOME_DES, des)
+	I.LENS = append(I.LENS, indexType(len(seq)))
+	if len(I.LENS) > 1 {
+		t.text = append(t.text, byte('|'))
+	}
+	t.text = append(t.text, seq...)
+	return nil
+}
+
+func (t *textBuilder) finish() {
+	reverse(t.text)
+	t.I.SEQ = append(t.text, byte('$'))
+	t.text = nil
+}
+
+//-----------------------------------------------------------------------------
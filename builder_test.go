@@ -0,0 +1,72 @@
+package fmic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexBuilder(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "g1.fa")
+	if err := os.WriteFile(file, []byte(">a\nACGTTGCA\n>b x\nGGGACT\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	b := NewIndexBuilder(BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 2})
+	b.AddFile(file)
+	b.AddReader("mem", strings.NewReader(">c\nTTTTACG\n"))
+	b.SetOutput(filepath.Join(dir, "out.fmi"))
+	p := &recordProgress{}
+	I, err := b.Build(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(I.GENOME_ID, ",") != "a,b,c" || I.GENOME_DES[1] != "x" || string(I.Extract(2, 0, 7)) != "TTTTACG" {
+		t.Fatalf("sequences %v %v", I.GENOME_ID, I.LENS)
+	}
+	if n := len(">a\nACGTTGCA\n>b x\nGGGACT\n>c\nTTTTACG\n"); p.bytes != int64(n) {
+		t.Errorf("%d bytes of %d read", p.bytes, n)
+	}
+	if err := I.SaveCompressedIndexContext(context.Background(), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	J, err := LoadCompressedIndexContext(context.Background(), filepath.Join(dir, "out.fmi"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(J.Extract(1, 0, 6)) != "GGGACT" {
+		t.Error("the saved index differs")
+	}
+
+	// The same records from one file.
+	all := filepath.Join(dir, "all.fa")
+	if err := os.WriteFile(all, []byte(">a\nACGTTGCA\n>b x\nGGGACT\n>c\nTTTTACG\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sameIndex(t, I, buildIndex(t, all, BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 2}))
+}
+
+func TestIndexBuilderErrors(t *testing.T) {
+	b := NewIndexBuilder(BuildOptions{Multiple: true, CompressionRatio: 4})
+	b.AddReader("m1", strings.NewReader(">a\nAC\n"))
+	b.AddReader("m2", strings.NewReader(">b\nGT\n>a\nAC\n"))
+	if _, err := b.Build(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "id a of m2 is also in m1") {
+		t.Errorf("duplicate ids: %v", err)
+	}
+	if _, err := NewIndexBuilder(BuildOptions{CompressionRatio: 4}).Build(context.Background(), nil); err == nil {
+		t.Error("an index was built without sources")
+	}
+
+	// Without a file, the index has nowhere to be saved by default.
+	b = NewIndexBuilder(BuildOptions{Multiple: true, CompressionRatio: 4})
+	b.AddReader("m1", strings.NewReader(">a\nAC\n"))
+	I, err := b.Build(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := I.SaveCompressedIndexContext(context.Background(), 0, nil); err == nil {
+		t.Error("an index read from a reader was saved without an output directory")
+	}
+}
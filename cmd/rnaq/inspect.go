@@ -0,0 +1,92 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	rnaq inspect: a summary of an index.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	fmic "github.com/vtphan/rnaq"
+)
+
+//-----------------------------------------------------------------------------
+func inspectCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "write the summary as JSON")
+	top := fs.Int("top", 5, "number of largest and smallest records to list")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rnaq inspect [flags] index.fmi\n")
+		fmt.Fprintf(fs.Output(), "Summarizes the records, symbols and components of the index.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	I, err := fmic.LoadCompressedIndexContext(ctx, fs.Arg(0), nil)
+	if err != nil {
+		return err
+	}
+	s, err := I.Stats(fs.Arg(0), *top)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "format version\t%d\n", s.FormatVersion)
+	fmt.Fprintf(w, "records\t%d (%d decoys)\n", s.Records, s.Decoys)
+	fmt.Fprintf(w, "total length\t%d (text %d, soft-masked %d)\n", s.TotalLength, s.TextLength, s.MaskedLength)
+	l := s.Lengths
+	fmt.Fprintf(w, "lengths\tmin %d, p25 %d, median %d, p75 %d, max %d, mean %.1f, N50 %d\n", l.Min, l.P25, l.Median, l.P75, l.Max, l.Mean, l.N50)
+	fmt.Fprintf(w, "compression ratio M\t%d\n", s.CompressionRatio)
+	fmt.Fprintf(w, "sampling\tSA every %d, ISA every %d (0 if not sampled)\n", s.SARate, s.ISARate)
+	fmt.Fprintf(w, "widths\t%d-byte indices, %d-byte sequence ids\n", s.IndexWidth, s.SequenceIDWidth)
+	fmt.Fprintf(w, "alphabet\t%s\n", s.Alphabet)
+	w.Flush()
+
+	fmt.Println("\nsymbols:")
+	var symbols []string
+	for symb := range s.Frequencies {
+		symbols = append(symbols, symb)
+	}
+	sort.Strings(symbols)
+	for _, symb := range symbols {
+		fmt.Fprintf(w, "  %q\t%d\t%.2f%%\n", symb, s.Frequencies[symb], 100*float64(s.Frequencies[symb])/float64(s.TextLength))
+	}
+	w.Flush()
+
+	fmt.Println("\ncomponents:")
+	fmt.Fprintf(w, "  name\tpresent\tmemory\tdisk\n")
+	for _, c := range s.Components {
+		fmt.Fprintf(w, "  %s\t%t\t%d\t%d\n", c.Name, c.Present, c.MemoryBytes, c.DiskBytes)
+	}
+	w.Flush()
+
+	for _, list := range []struct {
+		name    string
+		records []fmic.RecordStats
+	}{{"largest", s.Largest}, {"smallest", s.Smallest}} {
+		fmt.Printf("\n%s records:\n", list.name)
+		for _, r := range list.records {
+			fmt.Fprintf(w, "  %s\t%d\n", r.Name, r.Length)
+		}
+		w.Flush()
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,54 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Command line tools for FM indexes.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+)
+
+// Each command parses its own flags from args.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"inspect": inspectCommand,
+	"quant":   quantCommand,
+	"unique":  uniqueCommand,
+	"verify":  verifyCommand,
+}
+
+//-----------------------------------------------------------------------------
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: rnaq <command> [flags] ...\ncommands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%s\n", name)
+	}
+	os.Exit(2)
+}
+
+//-----------------------------------------------------------------------------
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := command(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "rnaq %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+//-----------------------------------------------------------------------------
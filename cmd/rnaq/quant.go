@@ -0,0 +1,158 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	rnaq quant: abundances of the targets from paired-end reads.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	fmic "github.com/vtphan/rnaq"
+)
+
+//-----------------------------------------------------------------------------
+func quantCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("quant", flag.ExitOnError)
+	reads1 := fs.String("1", "", "fastq file of the first reads of the pairs")
+	reads2 := fs.String("2", "", "fastq file of the second reads of the pairs")
+	out := fs.String("o", "quant", "output directory")
+	format := fs.String("format", "salmon", "output format: salmon or kallisto")
+	threads := fs.Int("threads", runtime.NumCPU(), "number of worker goroutines")
+	max_insert := fs.Int("max-insert", 500, "maximum insert size of a pair")
+	rounds := fs.Int("rounds", 0, "randomized rounds of seed search; 0 for a single deterministic round")
+	seed := fs.Int64("seed", 1, "seed of the randomized rounds and of the replicates")
+	fragment_length := fs.Float64("fragment-length", 200, "mean fragment length")
+	bias := fs.String("bias", "", "comma-separated bias models to correct: seq, gc, pos")
+	bootstraps := fs.Int("bootstraps", 0, "number of bootstrap replicates")
+	gibbs := fs.Int("gibbs", 0, "number of Gibbs replicates")
+	genes := fs.String("genes", "", "GTF/GFF3 annotation or tx2gene table to summarize the abundances by gene")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rnaq quant [flags] -1 reads_1.fq -2 reads_2.fq index.fmi\n")
+		fmt.Fprintf(fs.Output(), "Estimates the abundances of the targets, and writes them in the directory\nof -o as salmon (quant.sf) or kallisto (abundance.tsv) would.  With -genes,\nalso writes the gene abundances in genes.tsv, and the targets without a gene\nin genes_unmapped.txt.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *reads1 == "" || *reads2 == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != "salmon" && *format != "kallisto" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *bootstraps > 0 && *gibbs > 0 {
+		return errors.New("-bootstraps and -gibbs cannot be used together")
+	}
+	var err error
+	var bias_opt fmic.BiasOptions
+	if *bias != "" {
+		for _, model := range strings.Split(*bias, ",") {
+			switch model {
+			case "seq":
+				bias_opt.Sequence = true
+			case "gc":
+				bias_opt.GC = true
+			case "pos":
+				bias_opt.Positional = true
+			default:
+				return fmt.Errorf("unknown bias model %q", model)
+			}
+		}
+	}
+
+	var tx2gene fmic.Tx2Gene
+	if *genes != "" {
+		switch strings.ToLower(path.Ext(*genes)) {
+		case ".gtf", ".gff", ".gff3":
+			tx2gene, err = fmic.ReadTx2GeneGTF(*genes)
+		default:
+			tx2gene, err = fmic.ReadTx2Gene(*genes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	I, err := fmic.LoadCompressedIndexContext(ctx, fs.Arg(0), nil)
+	if err != nil {
+		return err
+	}
+	opt := fmic.QuantOptions{
+		Workers:   *threads,
+		MaxInsert: *max_insert,
+		Rounds:    *rounds,
+		Seed:      *seed,
+		Bias:      bias_opt != fmic.BiasOptions{},
+	}
+	E, err := I.QuantContext(ctx, *reads1, *reads2, opt, nil)
+	if err != nil {
+		return err
+	}
+	A := I.EstimateAbundance(E, fmic.EMOptions{FragmentLength: *fragment_length, Bias: bias_opt})
+	if opt.Bias && A.Bias == nil {
+		fmt.Fprintf(os.Stderr, "rnaq quant: no read pair was assigned to a single target; effective lengths are not corrected for bias\n")
+	}
+
+	info := fmic.RunInfo{
+		Command: os.Args,
+		Index:   fs.Arg(0),
+		Reads1:  *reads1,
+		Reads2:  *reads2,
+		Threads: *threads,
+		Start:   start,
+		Counts:  E,
+	}
+	rep_opt := fmic.ReplicateOptions{Method: fmic.Bootstrap, N: *bootstraps, Workers: *threads, Seed: *seed}
+	if *gibbs > 0 {
+		rep_opt.Method, rep_opt.N = fmic.Gibbs, *gibbs
+	}
+	if rep_opt.N > 0 {
+		if info.Replicates, err = A.Replicates(ctx, E, rep_opt); err != nil {
+			return err
+		}
+	}
+
+	if *format == "salmon" {
+		err = I.WriteSalmonOutput(*out, A, info)
+	} else {
+		err = I.WriteKallistoOutput(*out, A, info)
+	}
+	if err != nil {
+		return err
+	}
+	if A.Bias != nil {
+		if err = writeFile(path.Join(*out, "bias.tsv"), A.Bias.WriteTSV); err != nil {
+			return err
+		}
+	}
+	if tx2gene != nil {
+		G := A.SummarizeToGene(tx2gene)
+		if err = writeFile(path.Join(*out, "genes.tsv"), G.WriteTSV); err != nil {
+			return err
+		}
+		if len(G.Unmapped) > 0 {
+			fmt.Fprintf(os.Stderr, "rnaq quant: %d of %d targets have no gene; their ids are in %s\n",
+				len(G.Unmapped), len(A.IDs), path.Join(*out, "genes_unmapped.txt"))
+			if err = writeFile(path.Join(*out, "genes_unmapped.txt"), G.WriteUnmapped); err != nil {
+				return err
+			}
+		}
+	}
+	if R := info.Replicates; R != nil {
+		if err = writeFile(path.Join(*out, "replicates.gz"), R.WriteBinary); err != nil {
+			return err
+		}
+		return writeFile(path.Join(*out, "replicates.tsv"), R.WriteSummaryTSV)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
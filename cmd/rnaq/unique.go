@@ -0,0 +1,77 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	rnaq unique: which L-mers of each sequence are unique to it.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	fmic "github.com/vtphan/rnaq"
+)
+
+//-----------------------------------------------------------------------------
+func uniqueCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("unique", flag.ExitOnError)
+	L := fs.Int("L", 100, "read length")
+	out := fs.String("o", "unique", "prefix of the output files")
+	wig := fs.Bool("wig", false, "also write a wiggle track")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rnaq unique [flags] index.fmi\n")
+		fmt.Fprintf(fs.Output(), "Writes the unique fraction of the L-mers of each sequence to PREFIX.tsv,\nand which L-mers are unique to PREFIX.bedgraph.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	I, err := fmic.LoadCompressedIndexContext(ctx, fs.Arg(0), nil)
+	if err != nil {
+		return err
+	}
+	if I.LCP.Len() == 0 {
+		if len(I.SEQ) == 0 {
+			return errors.New("the index has no LCP array; build it with LCP, or save it with save_option 2")
+		}
+		if err = I.BuildLCP(ctx); err != nil {
+			return err
+		}
+	}
+	U, err := I.UniqueLmers(ctx, *L)
+	if err != nil {
+		return err
+	}
+
+	if err = writeFile(*out+".tsv", U.WriteFractions); err != nil {
+		return err
+	}
+	if err = writeFile(*out+".bedgraph", U.WriteBedGraph); err != nil {
+		return err
+	}
+	if *wig {
+		return writeFile(*out+".wig", U.WriteWiggle)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//-----------------------------------------------------------------------------
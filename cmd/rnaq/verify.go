@@ -0,0 +1,64 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	rnaq verify: check the invariants of an index.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	fmic "github.com/vtphan/rnaq"
+)
+
+//-----------------------------------------------------------------------------
+func verifyCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	records := fs.Int("records", 10, "records to reconstruct from the BWT and compare with SEQ")
+	seed := fs.Int64("seed", 1, "seed of the choice of records")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rnaq verify [flags] index.fmi\n")
+		fmt.Fprintf(fs.Output(), "Checks the invariants of the index, and fails if any of them does not hold.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	I, err := fmic.LoadCompressedIndexContext(ctx, fs.Arg(0), nil)
+	if err != nil {
+		return err
+	}
+	results, err := I.Verify(ctx, fmic.VerifyOptions{Records: *records, Seed: *seed})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		switch {
+		case !r.OK():
+			failed++
+			fmt.Printf("FAIL %s\n", r.Name)
+			for _, p := range r.Problems {
+				fmt.Printf("\t%s\n", p)
+			}
+			if r.More > 0 {
+				fmt.Printf("\tand %d more\n", r.More)
+			}
+		case r.Skipped != "":
+			fmt.Printf("skip %s: %s\n", r.Name, r.Skipped)
+		default:
+			fmt.Printf("ok   %s\n", r.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s failed %d of %d checks", fs.Arg(0), failed, len(results))
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -1,14 +1,16 @@
 package fmic
 
 // indexType is the type of the indices of the sequence to be indexed.
-// If indexType is uint32, the length of sequence must be smaller than 2^32.
-// For example, uint32 can be used for the human genome.  But int64 must
-// be used a collective metagenome that is longer than 4Gbp.
+// It is used for computation only: each index stores SA, ISA and OCC in
+// 4 bytes per entry if its text is shorter than 2^32 (e.g. the human genome),
+// and in 8 bytes otherwise (e.g. a collective metagenome longer than 4Gbp).
+// See IDX_WIDTH and Ints.
 
 type indexType int64
 
 
-// The number of sequences to be indexed together must be storable by a sequenceType
-// For example, use uint16 if there are no more than 2^16 sequences to be indexed at once.
+// sequenceType holds the id of a sequence.  It must be as wide as the widest
+// sequence id an index may use; each index stores its ids in 2 bytes if it
+// has no more than 2^16 sequences, and in 4 bytes otherwise (see SID_WIDTH).
 
-type sequenceType uint16
+type sequenceType uint32
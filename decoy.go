@@ -0,0 +1,98 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Decoy sequences, which absorb reads that do not come from any target.
+*/
+package fmic
+
+import (
+	"context"
+	"fmt"
+)
+
+//-----------------------------------------------------------------------------
+// Build the FM index of the targets in file together with the decoys in
+// decoy_file (e.g. the genome).  Decoys get the last NUM_DECOYS sequence ids,
+// so read pairs whose hits are all decoys can be told apart from assigned ones.
+//-----------------------------------------------------------------------------
+func CompressedIndexDecoy(file, decoy_file string, compression_ratio int) *IndexC {
+	opt := BuildOptions{CompressionRatio: compression_ratio, ISARate: compression_ratio}
+	I, err := CompressedIndexDecoyContext(context.Background(), file, decoy_file, opt, nil)
+	check_for_error(err)
+	return I
+}
+
+//-----------------------------------------------------------------------------
+func CompressedIndexDecoyContext(ctx context.Context, file, decoy_file string, opt BuildOptions, progress Progress) (*IndexC, error) {
+	progress = orNoProgress(progress)
+	opt.Multiple = true
+	I, err := newIndex(file, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Phase(PhaseReadFasta)
+	text := &textBuilder{I: I}
+	source := make(map[string]string) // the file of each id
+	read := func(f string) error {
+		return readFastaRecords(ctx, f, progress, func(id, des string, seq []byte) error {
+			if prev, ok := source[id]; ok {
+				return fmt.Errorf("CompressedIndexDecoy: id %s of %s is also in %s", id, f, prev)
+			}
+			source[id] = f
+			return text.add(id, des, seq)
+		})
+	}
+	if err := read(file); err != nil {
+		return nil, err
+	}
+	num_targets := len(I.LENS)
+	if err := read(decoy_file); err != nil {
+		return nil, err
+	}
+	I.NUM_DECOYS = len(I.LENS) - num_targets
+	text.finish()
+
+	if err := I.build(ctx, progress); err != nil {
+		return nil, err
+	}
+	return I, nil
+}
+
+//-----------------------------------------------------------------------------
+// Number of sequences that are not decoys; their ids are 0..NumTargets()-1.
+//-----------------------------------------------------------------------------
+func (I *IndexC) NumTargets() int {
+	return len(I.LENS) - I.NUM_DECOYS
+}
+
+//-----------------------------------------------------------------------------
+func (I *IndexC) IsDecoy(id int) bool {
+	return id >= I.NumTargets()
+}
+
+//-----------------------------------------------------------------------------
+// A pair that hits targets is assigned to them only.  A pair that hits
+// nothing but decoys keeps its decoy hits, so the caller can count it as decoy.
+//-----------------------------------------------------------------------------
+func (I *IndexC) resolveDecoys(out map[int]int) map[int]int {
+	if I.NUM_DECOYS == 0 {
+		return out
+	}
+	targets := false
+	for id := range out {
+		if !I.IsDecoy(id) {
+			targets = true
+			break
+		}
+	}
+	if targets {
+		for id := range out {
+			if I.IsDecoy(id) {
+				delete(out, id)
+			}
+		}
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,60 @@
+package fmic
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecoyIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	tx, chr := randSeq(r, 600), randSeq(r, 800)
+	dir := t.TempDir()
+	targets, decoys := filepath.Join(dir, "tx.fasta"), filepath.Join(dir, "genome.fasta")
+	os.WriteFile(targets, []byte(">t1 a\n"+tx+"\n"), 0666)
+	os.WriteFile(decoys, []byte(">chr1 x\n"+chr+tx[:300]+"\n"), 0666)
+	I, err := CompressedIndexDecoyContext(context.Background(), targets, decoys, BuildOptions{CompressionRatio: 4, ISARate: 4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if I.NUM_DECOYS != 1 || I.NumTargets() != 1 || !I.IsDecoy(1) {
+		t.Fatalf("%d decoys of %d sequences", I.NUM_DECOYS, len(I.LENS))
+	}
+	I.SaveCompressedIndex(1)
+	I = LoadCompressedIndex(targets + ".fmi")
+	if I.NUM_DECOYS != 1 {
+		t.Fatalf("%d decoys after loading", I.NUM_DECOYS)
+	}
+
+	var frags []fragment
+	for i := 0; i < 100; i++ {
+		frags = append(frags, fragment{1, r.Intn(500), 0}, fragment{0, 300 + r.Intn(150), 0})
+	}
+	recs := []string{tx, chr}
+	for k := range frags {
+		frags[k].end = frags[k].start + 150
+	}
+	r1, r2 := writePairs(recs, frags, 50)
+	E := I.QuantReader(r1, r2, QuantOptions{MaxInsert: 500})
+	// Seeds of random decoy reads may miss, but no decoy read is assigned.
+	if E.Assigned != 100 || E.Decoy < 95 {
+		t.Errorf("%d pairs assigned and %d decoys of 100 and 100", E.Assigned, E.Decoy)
+	}
+	if A := I.EstimateAbundance(E, EMOptions{}); len(A.NumReads) != 1 || A.NumReads[0] < 99.9 {
+		t.Errorf("%v pairs of the target", A.NumReads)
+	}
+}
+
+func TestDecoyIndexDuplicateIDs(t *testing.T) {
+	dir := t.TempDir()
+	targets, decoys := filepath.Join(dir, "tx.fasta"), filepath.Join(dir, "genome.fasta")
+	os.WriteFile(targets, []byte(">a x\nACGTACGT\n>b x\nGGGTTT\n"), 0666)
+	os.WriteFile(decoys, []byte(">chr1 x\nACGTTTGA\n>b x\nCCCAAA\n"), 0666)
+	_, err := CompressedIndexDecoyContext(context.Background(), targets, decoys, BuildOptions{CompressionRatio: 4, ISARate: 4}, nil)
+	if err == nil || !strings.Contains(err.Error(), "id b of "+decoys+" is also in "+targets) {
+		t.Errorf("error %v", err)
+	}
+}
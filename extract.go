@@ -0,0 +1,72 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Extraction of reference substrings from the compressed FM index.
+*/
+package fmic
+
+import (
+	"fmt"
+)
+
+//-----------------------------------------------------------------------------
+// Compute where each sequence starts in the original (unreversed) text,
+// in which sequences are separated by '|'.
+//-----------------------------------------------------------------------------
+func (I *IndexC) computeOffsets() {
+	I.offsets = make([]indexType, len(I.LENS))
+	var offset indexType
+	for k := range I.LENS {
+		I.offsets[k] = offset
+		offset += I.LENS[k] + 1
+	}
+}
+
+//-----------------------------------------------------------------------------
+// LF mapping: the row of the suffix that starts one position before SA[i].
+//-----------------------------------------------------------------------------
+func (I *IndexC) lf(i indexType) indexType {
+	c := I.BWT[i]
+	return I.C[c] + I.Occurence(c, i) - 1
+}
+
+//-----------------------------------------------------------------------------
+// Extract returns positions [start, end) of sequence seqID, in the same
+// orientation as the input fasta file.  If SEQ was not saved, the text is
+// reconstructed by LF-walking the BWT from the nearest sampled ISA entry.
+//-----------------------------------------------------------------------------
+func (I *IndexC) Extract(seqID int, start, end indexType) []byte {
+	if seqID < 0 || seqID >= len(I.LENS) {
+		panic(fmt.Sprintf("Extract: unknown sequence %d", seqID))
+	}
+	if start < 0 || start > end || end > I.LENS[seqID] {
+		panic(fmt.Sprintf("Extract: invalid range [%d,%d) of sequence %d", start, end, seqID))
+	}
+
+	// SEQ is reversed and ends with '$'; the text is in SEQ[a:b] backwards.
+	a := I.LEN - 1 - I.offsets[seqID] - end
+	b := I.LEN - 1 - I.offsets[seqID] - start
+	out := make([]byte, 0, end-start)
+	if len(I.SEQ) > 0 {
+		for p := b - 1; p >= a; p-- {
+			out = append(out, I.SEQ[p])
+		}
+		return out
+	}
+	if I.ISA_RATE <= 0 {
+		panic("Extract: index has neither SEQ nor a sampled ISA")
+	}
+
+	// Start from the closest sampled suffix at or after b.
+	k := (I.LEN - 1 - b) / I.ISA_RATE
+	i := I.ISA.Get(k)
+	for p := I.LEN - 1 - k*I.ISA_RATE; p > b; p-- {
+		i = I.lf(i)
+	}
+	for p := b; p > a; p-- {
+		out = append(out, I.BWT[i])
+		i = I.lf(i)
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,61 @@
+package fmic
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	recs := []string{randSeq(r, 50), randSeq(r, 73), randSeq(r, 1), randSeq(r, 200)}
+	file := writeFasta(t, recs)
+	for _, isa_rate := range []int{1, 5, 64} {
+		I := CompressedIndexSampled(file, true, 4, isa_rate)
+		I.SaveCompressedIndex(0)
+		// The loaded index has no SEQ, so it walks the BWT.
+		J := LoadCompressedIndex(file + ".fmi")
+		if len(J.SEQ) != 0 {
+			t.Fatal("SEQ was loaded")
+		}
+		for k, rec := range recs {
+			for s := 0; s <= len(rec); s++ {
+				for e := s; e <= len(rec); e++ {
+					want := rec[s:e]
+					if got := string(I.Extract(k, indexType(s), indexType(e))); got != want {
+						t.Fatalf("ISA rate %d: [%d,%d) of %d is %q with SEQ instead of %q", isa_rate, s, e, k, got, want)
+					}
+					if got := string(J.Extract(k, indexType(s), indexType(e))); got != want {
+						t.Fatalf("ISA rate %d: [%d,%d) of %d is %q without SEQ instead of %q", isa_rate, s, e, k, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestExtractInvalidRange(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	I := CompressedIndexSampled(writeFasta(t, []string{randSeq(r, 20), randSeq(r, 30)}), true, 4, 4)
+	for _, c := range []struct {
+		k          int
+		start, end indexType
+	}{{2, 0, 1}, {-1, 0, 1}, {0, 5, 4}, {0, 0, 21}, {1, -1, 3}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Extract(%d, %d, %d) did not panic", c.k, c.start, c.end)
+				}
+			}()
+			I.Extract(c.k, c.start, c.end)
+		}()
+	}
+	// Without SEQ or a sampled ISA, nothing can be extracted.
+	J := CompressedIndexSampled(writeFasta(t, []string{"ACGT"}), true, 4, 0)
+	J.SEQ = nil
+	defer func() {
+		if recover() == nil {
+			t.Error("Extract without SEQ or ISA did not panic")
+		}
+	}()
+	J.Extract(0, 0, 1)
+}
@@ -0,0 +1,175 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Reading of fasta files, possibly compressed.
+*/
+package fmic
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Magic bytes at the start of compressed files.
+var (
+	gzip_magic  = []byte{0x1f, 0x8b}
+	bzip2_magic = []byte("BZh")
+	zstd_magic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+//-----------------------------------------------------------------------------
+// Returns the content of r, decompressed if it starts with the magic bytes
+// of gzip, bzip2 or zstd.  name is used in errors.
+//-----------------------------------------------------------------------------
+func decompress(name string, r *bufio.Reader) (io.Reader, error) {
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, gzip_magic):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return gz, nil
+	case bytes.HasPrefix(magic, bzip2_magic):
+		return bzip2.NewReader(r), nil
+	case bytes.HasPrefix(magic, zstd_magic):
+		return newZstdReader(r), nil
+	}
+	return r, nil
+}
+
+//-----------------------------------------------------------------------------
+// Call f on each record of a fasta file, in order.  The file may be
+// compressed, and its lines may be of any length and end in "\r\n".  The id
+// of a record is its header up to the first space or tab, and the rest is
+// its description, which may be empty.  Sequences may not contain the '|'
+// and '$' of the index text.  A file without records, a record without
+// sequence and a repeated id are errors.
+//-----------------------------------------------------------------------------
+func readFastaRecords(ctx context.Context, file string, progress Progress, f func(id, des string, seq []byte) error) error {
+	progress = orNoProgress(progress)
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return readFastaFrom(ctx, file, in, progress.BytesRead, f)
+}
+
+//-----------------------------------------------------------------------------
+// Same as readFastaRecords, but reads from in; file is only used in errors.
+// bytesRead, if not nil, gets the number of bytes read from in.
+//-----------------------------------------------------------------------------
+func readFastaFrom(ctx context.Context, file string, in io.Reader, bytesRead func(int64), f func(id, des string, seq []byte) error) error {
+	content, err := decompress(file, bufio.NewReaderSize(&ctxReader{ctx: ctx, r: in, bytesRead: bytesRead}, 1<<16))
+	if err != nil {
+		return err
+	}
+	r, ok := content.(*bufio.Reader)
+	if !ok {
+		r = bufio.NewReaderSize(content, 1<<16)
+	}
+
+	var id, des string
+	var seq, header []byte
+	header_line := make(map[string]int) // line of the header of each id
+	line_num := 0
+	in_record, line_start, in_header := false, true, false
+
+	end_record := func() error {
+		if !in_record {
+			return nil
+		}
+		if len(seq) == 0 {
+			return fmt.Errorf("%s:%d: record %s has no sequence", file, header_line[id], id)
+		}
+		if i := bytes.IndexAny(seq, "|$"); i >= 0 {
+			return fmt.Errorf("%s:%d: record %s contains '%c', which cannot be indexed", file, header_line[id], id, seq[i])
+		}
+		return f(id, des, seq)
+	}
+	start_record := func() error {
+		if err := end_record(); err != nil {
+			return err
+		}
+		line := strings.TrimSpace(string(header[1:]))
+		id, des = line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			id, des = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if id == "" {
+			return fmt.Errorf("%s:%d: header has no id", file, line_num)
+		}
+		if prev, ok := header_line[id]; ok {
+			return fmt.Errorf("%s:%d: id %s was already used on line %d", file, line_num, id, prev)
+		}
+		header_line[id] = line_num
+		seq, in_record = nil, true
+		return nil
+	}
+
+	for {
+		// ReadSlice returns long lines in several chunks.
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 {
+			if line_start {
+				line_num++
+				in_header = chunk[0] == '>'
+				header = header[:0]
+			}
+			line_start = chunk[len(chunk)-1] == '\n'
+			if in_header {
+				header = append(header, chunk...)
+				if line_start {
+					if err := start_record(); err != nil {
+						return err
+					}
+				}
+			} else {
+				n := len(seq)
+				seq = appendSequence(seq, chunk)
+				if !in_record && len(seq) > n {
+					return fmt.Errorf("%s:%d: sequence before the first header", file, line_num)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+	if !line_start && in_header {
+		if err = start_record(); err != nil {
+			return err
+		}
+	}
+	if len(header_line) == 0 {
+		return fmt.Errorf("%s has no fasta records", file)
+	}
+	return end_record()
+}
+
+//-----------------------------------------------------------------------------
+// Append chunk to seq without its white space.
+//-----------------------------------------------------------------------------
+func appendSequence(seq, chunk []byte) []byte {
+	for len(chunk) > 0 {
+		i := bytes.IndexAny(chunk, " \t\r\n")
+		if i < 0 {
+			return append(seq, chunk...)
+		}
+		seq = append(seq, chunk[:i]...)
+		chunk = chunk[i+1:]
+	}
+	return seq
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,81 @@
+package fmic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fasta_content compressed with bzip2 -9.
+const fasta_bzip2 = "425a6839314159265359949254cb0000075f80003240000001288004003f619c0020007228d190346991a08a89a034f5064d2bbd2922b1c673e75c46ee9290a822803281044500729ec8088a00cd011140187118faf6b17c4ecf2b63e2ee48a70a1212924a9960"
+
+// Windows line ends, a line of 200000 bases, an empty line, no final line
+// end, and headers with and without descriptions.
+var fasta_content = ">a first one\r\nACGT\r\nAC\r\n>b\n" + strings.Repeat("ACGT", 50000) + "\n\n>c\tdesc here\nGG"
+
+func TestReadFasta(t *testing.T) {
+	dir := t.TempDir()
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(fasta_content))
+	zw.Close()
+	bz, err := hex.DecodeString(fasta_bzip2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{"x.fa": []byte(fasta_content), "x.fna.gz": gz.Bytes(), "x.bz2": bz, "x": []byte(fasta_content)} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, content, 0666); err != nil {
+			t.Fatal(err)
+		}
+		var ids, des, seqs []string
+		err := readFastaRecords(context.Background(), file, nil, func(id, d string, seq []byte) error {
+			ids, des, seqs = append(ids, id), append(des, d), append(seqs, string(seq))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if strings.Join(ids, ",") != "a,b,c" || strings.Join(des, ",") != "first one,,desc here" {
+			t.Fatalf("%s: ids %q and descriptions %q", name, ids, des)
+		}
+		if seqs[0] != "ACGTAC" || seqs[1] != strings.Repeat("ACGT", 50000) || seqs[2] != "GG" {
+			t.Errorf("%s: sequences differ", name)
+		}
+		I := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4})
+		if string(I.Extract(1, 0, 8)) != "ACGTACGT" || string(I.Extract(2, 0, 2)) != "GG" || I.GENOME_DES[2] != "desc here" {
+			t.Errorf("%s: index differs", name)
+		}
+	}
+}
+
+func TestReadFastaErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct{ content, err string }{
+		{">a\nAC\n>a\nGG\n", "x:3: id a was already used on line 1"},
+		{">a\n>b\nAC\n", "x:1: record a has no sequence"},
+		{">a\nAC\n>b\n", "x:3: record b has no sequence"},
+		{"AC\n>a\nAC\n", "x:1: sequence before the first header"},
+		{"", "x has no fasta records"},
+		{"\n\n", "x has no fasta records"},
+		{">\nAC\n", "x:1: header has no id"},
+		{"> \t\r\nAC\n", "x:1: header has no id"},
+		{">a\nA|C\n", "x:1: record a contains '|', which cannot be indexed"},
+		{">a\nAC$\n", "x:1: record a contains '$', which cannot be indexed"},
+		{"\x1f\x8b\x08junk", "unexpected EOF"},
+	} {
+		file := filepath.Join(dir, "x")
+		if err := os.WriteFile(file, []byte(c.content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		err := readFastaRecords(context.Background(), file, nil, func(id, d string, seq []byte) error { return nil })
+		if err == nil || !strings.HasSuffix(err.Error(), c.err) {
+			t.Errorf("%q: error %v instead of %s", c.content, err, c.err)
+		}
+	}
+}
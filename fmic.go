@@ -5,26 +5,28 @@
 package fmic
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
-	"os"
+	"runtime"
 	"sort"
 )
 
 //-----------------------------------------------------------------------------
 // Global variables: sequence (SEQ), suffix array (SA), BWT, FM index (C, OCC)
+// An IndexC is read-only once CompressedIndex or LoadCompressedIndex returns,
+// so its search methods may be called from many goroutines at once.
 //-----------------------------------------------------------------------------
 
 type IndexC struct {
 	SEQ []byte
 	BWT []byte
-	SA  []indexType          // suffix array
-	SSA []sequenceType       // SSA[i] stores the sequence containing position SA[i]
-	C   map[byte]indexType   // count table
-	OCC map[byte][]indexType // occurence table
+	SA  Ints               // suffix array, or its samples if SA_RATE > 0 (see Locate)
+	SSA Ints               // SSA[i] stores the sequence containing position SA[i]
+	C   map[byte]indexType // count table
+	OCC map[byte]Ints      // occurence table
 
 	END_POS indexType          // position of "$" in the text
 	SYMBOLS []int              // sorted symbols
@@ -38,72 +40,352 @@ type IndexC struct {
 	Freq       map[byte]indexType // Frequency of each symbol
 	M          int                // Compression ratio
 	Multiple   bool               // True if the input contains multiple sequences
+	ISA        Ints               // sampled inverse suffix array (see Extract)
+	ISA_RATE   indexType          // ISA[k] is the row of suffix LEN-1-k*ISA_RATE; 0 if not sampled
+	NUM_DECOYS int                // the last NUM_DECOYS sequences are decoys
+	SID_WIDTH  int                // bytes per sequence id in SSA (2 or 4)
+	IDX_WIDTH  int                // bytes per entry of SA, ISA and OCC (4 or 8)
+	NO_SSA     bool               // if true, SequenceOf searches offsets instead of SSA
+	SA_RATE    indexType          // SA holds the positions that are multiples of SA_RATE; 0 if it holds all
+	SA_MARK    BitVector          // rows whose position is sampled in SA, if SA_RATE > 0
+	NO_SA      bool               // if true, no suffix array is kept, so Locate cannot be used
+	LCP        Ints               // LCP[i] is the longest common prefix of rows i-1 and i (see BuildLCP)
+	ALPHABET   Alphabet           // normalization of the text, and of queries
+	MASKS      [][]Interval       // MASKS[k] are the sorted soft-masked intervals of sequence k; nil if not kept
 	input_file string
+	offsets    []indexType // offsets[k] is where sequence k starts in the original text
+
+	memory_budget    int64         // bytes for sorting suffixes; 0 to sort them all in memory
+	save_dir         string        // where the index is saved, if not input_file.fmi
+	workers          int           // goroutines inducing suffixes (see induceSortL0Parallel)
+	with_lcp         bool          // build the LCP array too
+	lcp_rmq          [][]indexType // lcp_rmq[l][b] is the minimum of LCP over blocks b..b+2^l-1
+	soft_mask        bool          // keep the lowercase runs of the text in MASKS
+	format_version   int           // see FormatVersion
+	query_normalizer *normalizer   // normalizes queries by ALPHABET; nil if it keeps every symbol
+}
+
+//-----------------------------------------------------------------------------
+// Options of index construction.
+//-----------------------------------------------------------------------------
+type BuildOptions struct {
+	Multiple         bool // true if the input contains multiple sequences
+	CompressionRatio int  // sampling rate of the occurence table (>= 1)
+	ISARate          int  // sampling rate of the inverse suffix array; 0 for none
+	SIDWidth         int  // bytes per sequence id: 2, 4, or 0 for the narrowest that fits
+	IndexWidth       int  // bytes per entry of SA, ISA and OCC: 4, 8, or 0 for the narrowest that fits
+	NoSSA            bool // find the sequence of a position by binary search instead of storing SSA
+	SARate           int  // sampling rate of the suffix array; 0 to keep all of it
+	NoSA             bool // keep no suffix array, e.g. if the index is saved with save_option 0
+	LCP              bool // build the LCP array; needs the full suffix array
+	Workers          int  // goroutines of the induce passes of SA-IS: 0 for GOMAXPROCS, sequential if 1
+
+	// Normalization of the text, which is saved with the index so that
+	// queries are normalized the same way.
+	Alphabet Alphabet
+
+	// Keep the lowercase runs of each sequence in MASKS, and fold them to
+	// uppercase; it implies Alphabet.FoldCase.
+	SoftMask bool
+
+	// If MemoryBudget > 0, suffixes are sorted in blocks of at most
+	// MemoryBudget bytes, whose BWTs are merged (see sortBlockwise).  The
+	// text, the BWT, and SA, SSA and ISA as the other options ask for them
+	// are held in memory regardless.  Workers are not used.
+	MemoryBudget int64
+}
+
+//-----------------------------------------------------------------------------
+func newIndex(file string, opt BuildOptions) (*IndexC, error) {
+	if opt.CompressionRatio < 1 {
+		return nil, fmt.Errorf("newIndex: compression ratio %d is smaller than 1", opt.CompressionRatio)
+	}
+	if opt.SIDWidth != 0 && opt.SIDWidth != 2 && opt.SIDWidth != 4 {
+		return nil, fmt.Errorf("newIndex: sequence ids cannot be %d bytes wide", opt.SIDWidth)
+	}
+	if opt.IndexWidth != 0 && opt.IndexWidth != 4 && opt.IndexWidth != 8 {
+		return nil, fmt.Errorf("newIndex: indices cannot be %d bytes wide", opt.IndexWidth)
+	}
+	if opt.ISARate < 0 || opt.SARate < 0 || opt.MemoryBudget < 0 {
+		return nil, fmt.Errorf("newIndex: sampling rates and memory budget cannot be negative")
+	}
+	if opt.LCP && (opt.SARate > 0 || opt.NoSA) {
+		return nil, fmt.Errorf("newIndex: the LCP array needs the full suffix array")
+	}
+	if opt.NoSSA && opt.NoSA {
+		return nil, fmt.Errorf("newIndex: without SSA, sequences are found through the suffix array, so NoSSA needs it")
+	}
+	I := new(IndexC)
+	I.input_file = file
+	I.M = opt.CompressionRatio
+	I.Multiple = opt.Multiple
+	I.ISA_RATE = indexType(opt.ISARate)
+	I.SID_WIDTH = opt.SIDWidth
+	I.IDX_WIDTH = opt.IndexWidth
+	I.NO_SSA = opt.NoSSA
+	I.SA_RATE = indexType(opt.SARate)
+	I.NO_SA = opt.NoSA
+	I.memory_budget = opt.MemoryBudget
+	I.workers = opt.Workers
+	if I.workers == 0 {
+		I.workers = runtime.GOMAXPROCS(0)
+	}
+	I.with_lcp = opt.LCP
+	I.soft_mask = opt.SoftMask
+	if opt.SoftMask {
+		opt.Alphabet.FoldCase = true
+	}
+	if err := I.setAlphabet(opt.Alphabet); err != nil {
+		return nil, fmt.Errorf("newIndex: %v", err)
+	}
+	return I, nil
+}
+
+//-----------------------------------------------------------------------------
+// Returns an error if n sequences have more ids than SID_WIDTH allows
+// (the widest width if SID_WIDTH is not chosen yet).
+//-----------------------------------------------------------------------------
+func (I *IndexC) checkNumSequences(n int) error {
+	width := I.SID_WIDTH
+	if width == 0 {
+		width = 4
+	}
+	if uint64(n) > maxIntsValue(width)+1 {
+		return fmt.Errorf("more than %d sequences do not fit in %d-byte sequence ids", maxIntsValue(width)+1, width)
+	}
+	return nil
 }
 
 //-----------------------------------------------------------------------------
 // Build FM index given the file storing the text.
 // multiple is true if the input file contains multiple sequences
 // compression ratio >=1
+// The inverse suffix array is sampled at the compression ratio.
 //-----------------------------------------------------------------------------
 func CompressedIndex(file string, multiple bool, compression_ratio int) *IndexC {
-	I := new(IndexC)
-	I.input_file = file
-	I.M = compression_ratio
-	I.Multiple = multiple
+	return CompressedIndexSampled(file, multiple, compression_ratio, compression_ratio)
+}
+
+//-----------------------------------------------------------------------------
+// Same as CompressedIndex, but with an explicit sampling rate of the inverse
+// suffix array.  Smaller rates make Extract faster at the cost of memory.
+// isa_rate is 0 if the inverse suffix array should not be sampled.
+//-----------------------------------------------------------------------------
+func CompressedIndexSampled(file string, multiple bool, compression_ratio, isa_rate int) *IndexC {
+	opt := BuildOptions{Multiple: multiple, CompressionRatio: compression_ratio, ISARate: isa_rate}
+	I, err := CompressedIndexContext(context.Background(), file, opt, nil)
+	check_for_error(err)
+	return I
+}
+
+//-----------------------------------------------------------------------------
+// Same as CompressedIndexSampled, but returns ctx.Err() as soon as the build
+// notices that ctx is done, and reports its phases to progress.
+//-----------------------------------------------------------------------------
+func CompressedIndexContext(ctx context.Context, file string, opt BuildOptions, progress Progress) (*IndexC, error) {
+	progress = orNoProgress(progress)
+	I, err := newIndex(file, opt)
+	if err != nil {
+		return nil, err
+	}
 
 	// GET THE SEQUENCE
-	I.ReadFasta(file)
+	progress.Phase(PhaseReadFasta)
+	if err := I.readFasta(ctx, file, progress); err != nil {
+		return nil, err
+	}
+	if err := I.build(ctx, progress); err != nil {
+		return nil, err
+	}
+	return I, nil
+}
+
+//-----------------------------------------------------------------------------
+// Build the suffix array, BWT and occurence table of I.SEQ.
+//-----------------------------------------------------------------------------
+func (I *IndexC) build(ctx context.Context, progress Progress) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, ok := r.(cancelled)
+			if !ok {
+				panic(r)
+			}
+			err = c.err
+		}
+	}()
+
+	if I.soft_mask {
+		I.computeOffsets()
+		I.findMasks()
+	}
+	if n := I.ALPHABET.normalizer(false); n != nil {
+		n.apply(I.SEQ)
+	}
 
 	// BUILD SUFFIX ARRAY
+	progress.Phase(PhaseSuffixArray)
 	I.LEN = indexType(len(I.SEQ))
 	I.OCC_SIZE = indexType(math.Ceil(float64(I.LEN/indexType(I.M)))) + 1
-	I.SA = make([]indexType, I.LEN)
-	var SID []sequenceType
-	if I.Multiple {
-		I.SSA = make([]sequenceType, I.LEN)
-		SID = make([]sequenceType, I.LEN)
+	if I.IDX_WIDTH == 0 {
+		I.IDX_WIDTH = 4
+		if uint64(I.LEN) > maxIntsValue(4) {
+			I.IDX_WIDTH = 8
+		}
+	}
+	if uint64(I.LEN) > maxIntsValue(I.IDX_WIDTH) {
+		return fmt.Errorf("a text of length %d does not fit in %d-byte indices", I.LEN, I.IDX_WIDTH)
+	}
+	if err = I.checkNumSequences(len(I.LENS)); err != nil {
+		return err
+	}
+	if I.SID_WIDTH == 0 {
+		I.SID_WIDTH = 2
+		if uint64(len(I.LENS)) > maxIntsValue(2)+1 {
+			I.SID_WIDTH = 4
+		}
+	}
+	rows := I.newRowBuilder()
+	if I.memory_budget > 0 {
+		err = I.sortBlockwise(ctx, progress, rows)
+	} else {
+		err = I.sortInMemory(ctx, progress, rows)
 	}
+	if err != nil {
+		return err
+	}
+	if I.SA_RATE > 0 {
+		I.SA_MARK.buildRanks()
+	}
+	I.computeOffsets()
+	if err = I.buildOCC(ctx, progress); err != nil {
+		return err
+	}
+	if I.with_lcp {
+		progress.Phase(PhaseLCP)
+		return I.BuildLCP(ctx)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Sort all suffixes at once with SA-IS, whose induce passes run in parallel
+// if I.workers > 1.
+//-----------------------------------------------------------------------------
+func (I *IndexC) sortInMemory(ctx context.Context, progress Progress, rows *rowBuilder) error {
+	// The BWT is built during the last stage of SA-IS, as each row becomes final.
 	SA := make([]int, I.LEN)
-	ws := &WorkSpace{}
-	ws.ComputeSuffixArray(I.SEQ, SA)
-	sid := sequenceType(0)
-	for i := range SA {
-		I.SA[i] = indexType(SA[i])
-		if I.Multiple {
-			SID[i] = sid
-			if I.SEQ[i] == '|' {
-				sid++
+	rows.descending = true
+	ws := &WorkSpace{
+		workers: I.workers,
+		stage: func(stage string) {
+			if ctx.Err() != nil {
+				panic(cancelled{ctx.Err()})
 			}
-		}
+			progress.Phase(PhaseSuffixArray + ": " + stage)
+		},
+		emit: func(i, p int) {
+			if i%check_interval == 0 && ctx.Err() != nil {
+				panic(cancelled{ctx.Err()})
+			}
+			rows.add(indexType(i), indexType(p))
+		},
 	}
+	ws.ComputeSuffixArray(I.SEQ, SA)
+	return ctx.Err()
+}
 
-	// BUILD BWT
+//-----------------------------------------------------------------------------
+// rowBuilder fills BWT, SA, SSA and ISA from the suffix of each row.  Rows
+// must be added in increasing order, or in decreasing order if descending.
+//-----------------------------------------------------------------------------
+type rowBuilder struct {
+	I          *IndexC
+	seps       []indexType // positions of '|' in SEQ
+	sampled    indexType   // number of positions sampled in SA so far
+	descending bool
+}
+
+func (I *IndexC) newRowBuilder() *rowBuilder {
+	b := &rowBuilder{I: I}
 	I.Freq = make(map[byte]indexType)
 	I.BWT = make([]byte, I.LEN)
-	var i indexType
-	for i = 0; i < I.LEN; i++ {
-		I.Freq[I.SEQ[i]]++
-		if I.SA[i] == 0 {
-			I.BWT[i] = I.SEQ[I.LEN-1]
-		} else {
-			I.BWT[i] = I.SEQ[I.SA[i]-1]
-		}
-		if I.BWT[i] == '$' {
-			I.END_POS = i
+	if I.NO_SA {
+		I.SA_RATE = 0
+	} else if I.SA_RATE > 0 {
+		I.SA = NewInts(I.IDX_WIDTH, (I.LEN-1)/I.SA_RATE+1)
+		I.SA_MARK = NewBitVector(I.LEN)
+	} else {
+		I.SA = NewInts(I.IDX_WIDTH, I.LEN)
+	}
+	if I.Multiple && !I.NO_SSA {
+		I.SSA = NewInts(I.SID_WIDTH, I.LEN)
+		for p, c := range I.SEQ {
+			if c == '|' {
+				b.seps = append(b.seps, indexType(p))
+			}
 		}
-		if I.Multiple {
-			// I.SSA[i] = SID[I.SA[i]]
-			I.SSA[i] = sid - SID[I.SA[i]]   // This is because I.SEQ is reversed.
+	}
+	if I.ISA_RATE > 0 {
+		I.ISA = NewInts(I.IDX_WIDTH, (I.LEN-1)/I.ISA_RATE+1)
+	}
+	return b
+}
+
+//-----------------------------------------------------------------------------
+// Row i holds the suffix at position p of SEQ.
+//-----------------------------------------------------------------------------
+func (b *rowBuilder) add(i, p indexType) {
+	I := b.I
+	I.Freq[I.SEQ[i]]++
+	if p == 0 {
+		I.BWT[i] = I.SEQ[I.LEN-1]
+	} else {
+		I.BWT[i] = I.SEQ[p-1]
+	}
+	if I.BWT[i] == '$' {
+		I.END_POS = i
+	}
+	switch {
+	case I.NO_SA:
+	case I.SA_RATE == 0:
+		I.SA.Set(i, p)
+	case p%I.SA_RATE == 0:
+		I.SA_MARK.Set(i)
+		if b.descending {
+			I.SA.Set(I.SA.Len()-1-b.sampled, p)
+		} else {
+			I.SA.Set(b.sampled, p)
 		}
+		b.sampled++
+	}
+	if I.SSA.Len() > 0 {
+		I.SSA.Set(i, b.sequence(p))
 	}
+	// Sample the inverse suffix array, counting from the end of the text.
+	if d := I.LEN - 1 - p; I.ISA_RATE > 0 && d%I.ISA_RATE == 0 {
+		I.ISA.Set(d/I.ISA_RATE, i)
+	}
+}
 
-	// BUILD COUNT AND OCCURENCE TABLE
+//-----------------------------------------------------------------------------
+// Returns the id of the sequence that contains position p of SEQ.
+//-----------------------------------------------------------------------------
+func (b *rowBuilder) sequence(p indexType) indexType {
+	// Sequences are numbered from the end, because I.SEQ is reversed.
+	before := sort.Search(len(b.seps), func(k int) bool { return b.seps[k] >= p })
+	return indexType(len(b.seps) - before)
+}
+
+//-----------------------------------------------------------------------------
+// Build the count and occurence tables from the BWT.
+//-----------------------------------------------------------------------------
+func (I *IndexC) buildOCC(ctx context.Context, progress Progress) error {
+	progress.Phase(PhaseOCC)
 	I.C = make(map[byte]indexType)
-	I.OCC = make(map[byte][]indexType)
+	I.OCC = make(map[byte]Ints)
 	for c := range I.Freq {
 		I.SYMBOLS = append(I.SYMBOLS, int(c))
-		I.OCC[c] = make([]indexType, I.OCC_SIZE)
+		I.OCC[c] = NewInts(I.IDX_WIDTH, I.OCC_SIZE)
 		I.C[c] = 0
 	}
 	sort.Ints(I.SYMBOLS)
@@ -118,21 +400,24 @@ func CompressedIndex(file string, multiple bool, compression_ratio int) *IndexC
 	}
 
 	for j := 0; j < len(I.BWT); j++ {
+		if j%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
 		count[I.BWT[j]] += 1
 		if j%I.M == 0 {
 			for symbol := range I.OCC {
-				I.OCC[symbol][int(j/I.M)] = count[symbol]
+				I.OCC[symbol].Set(indexType(j/I.M), count[symbol])
 			}
 		}
 	}
 
-	return I
+	return nil
 }
 
 //-----------------------------------------------------------------------------
 func (I *IndexC) Occurence(c byte, pos indexType) indexType {
 	i := indexType(pos / indexType(I.M))
-	count := I.OCC[c][i]
+	count := I.OCC[c].Get(i)
 	for j := i*indexType(I.M) + 1; j <= pos; j++ {
 		if I.BWT[j] == c {
 			count += 1
@@ -141,17 +426,63 @@ func (I *IndexC) Occurence(c byte, pos indexType) indexType {
 	return count
 }
 
+//-----------------------------------------------------------------------------
+// Returns SA[i].  If the suffix array is sampled, LF-walk from row i to the
+// nearest sampled position before it; that takes fewer than SA_RATE steps.
+//-----------------------------------------------------------------------------
+func (I *IndexC) Locate(i indexType) indexType {
+	if I.SA.Len() == 0 {
+		panic("Locate: index has no suffix array")
+	}
+	if I.SA_RATE == 0 {
+		return I.SA.Get(i)
+	}
+	var steps indexType
+	for !I.SA_MARK.Get(i) {
+		i = I.lf(i)
+		steps++
+	}
+	return I.SA.Get(I.SA_MARK.Rank(i)) + steps
+}
+
+//-----------------------------------------------------------------------------
+// Returns the sequence that contains the suffix of row i, i.e. position SA[i].
+// Without SSA, the position is mapped back to the original text, and the
+// sequence is found by binary search over the sequence offsets.
+//-----------------------------------------------------------------------------
+func (I *IndexC) SequenceOf(i indexType) int {
+	if I.SSA.Len() > 0 {
+		return int(I.SSA.Get(i))
+	}
+	return I.sequenceAt(I.LEN - 2 - I.Locate(i))
+}
+
+//-----------------------------------------------------------------------------
+// Returns the sequence that contains position g of the original text.  As in
+// SSA, the separator before a sequence belongs to it.
+//-----------------------------------------------------------------------------
+func (I *IndexC) sequenceAt(g indexType) int {
+	k := sort.Search(len(I.offsets), func(k int) bool { return I.offsets[k] > g+1 })
+	if k == 0 {
+		return 0
+	}
+	return k - 1
+}
+
 // -----------------------------------------------------------------------------
 // Returns starting, ending positions (sp, ep) and last-matched position (i)
+// The query is normalized by ALPHABET.  If it has a symbol that the text has
+// not, the range is empty (sp > ep).
 
 func (I *IndexC) Search(query []byte) (int, int) {
+	query = I.normalizeQuery(query)
 	var offset indexType
 	var i int
 	start_pos := 0
 	c := query[start_pos]
 	sp, ok := I.C[c]
 	if !ok {
-		panic("Unknown character: " + string(c))
+		return 0, -1
 	}
 	ep := I.EP[c]
 	// fmt.Println(i, string(c), sp, ep)
@@ -159,7 +490,7 @@ func (I *IndexC) Search(query []byte) (int, int) {
 		c = query[i]
 		offset, ok = I.C[c]
 		if !ok {
-			panic("Unknown character: " + string(c))
+			return 0, -1
 		}
 		sp = offset + I.Occurence(c, sp-1)
 		ep = offset + I.Occurence(c, ep) - 1
@@ -171,6 +502,7 @@ func (I *IndexC) Search(query []byte) (int, int) {
 //-----------------------------------------------------------------------------
 func (I *IndexC) TestSearch(query []byte) map[sequenceType][]indexType {
 	const maxSize = 1
+	query = I.normalizeQuery(query)
 	idSet := map[sequenceType][]indexType{}
 	var offset indexType
 	var i int
@@ -183,7 +515,8 @@ func (I *IndexC) TestSearch(query []byte) map[sequenceType][]indexType {
 			if ep-sp <= maxSize && flag == true {
 				flag = false
 				for i := sp; i <= ep; i++ {
-					idSet[I.SSA[i]] = append(idSet[I.SSA[i]], I.SA[i])
+					id := sequenceType(I.SequenceOf(i))
+					idSet[id] = append(idSet[id], I.Locate(i))
 				}
 			}
 			c = query[i]
@@ -199,52 +532,78 @@ func (I *IndexC) TestSearch(query []byte) map[sequenceType][]indexType {
 }
 
 //-----------------------------------------------------------------------------
-func (I *IndexC) regionSearch(query []byte, start_pos int) (int, int, map[sequenceType]indexType) {
+// The query must be normalized.  If the alphabet splits seeds at N, the seed
+// that starts at start_pos ends before the first N.  The last result is the
+// length of the seed whose hits are in idSet.
+//-----------------------------------------------------------------------------
+func (I *IndexC) regionSearch(query []byte, start_pos int) (int, int, map[sequenceType]indexType, int) {
 	const maxSize = 10
 	idSet := map[sequenceType]indexType{}
 	flag := true
+	length := 0
 	var id sequenceType
 	var offset, pos indexType
 	var i int
+	if start_pos >= len(query) {
+		return -1, -1, idSet, 0
+	}
+	split := I.ALPHABET.SplitAtN
 	c := query[start_pos]
 	sp, ok := I.C[c]
-	if !I.Multiple || !ok {
-		return -1,-1,idSet
+	if !I.Multiple || !ok || split && isN(c) {
+		return -1,-1,idSet,0
 	}
 	ep := I.EP[c]
 	for i = int(start_pos + 1); sp < ep && i < len(query); i++ {
 		if ep-sp <= maxSize && flag == true {
 			flag = false
+			length = i - start_pos
 			for i := sp; i <= ep; i++ {
-				idSet[I.SSA[i]] = I.SA[i]
+				idSet[sequenceType(I.SequenceOf(i))] = I.Locate(i)
 			}
 			// If all regions are the same, return.  Else, continue.
 			if len(idSet) == 1 {
 				for id, pos = range idSet {
-					return int(id), int(pos), idSet
+					return int(id), int(pos), idSet, length
 				}
 			}
 		}
 		c = query[i]
+		if split && isN(c) {
+			break
+		}
 		offset, ok = I.C[c]
 		if !ok {
-			return -1,-1,idSet
+			return -1,-1,idSet,length
 		}
 		sp = offset + I.Occurence(c, sp-1)
 		ep = offset + I.Occurence(c, ep) - 1
 	}
+	if flag {
+		length = i - start_pos
+	}
 	if sp == ep {
-		idSet[I.SSA[sp]] = I.SA[sp]
-		return int(I.SSA[sp]), int(I.SA[sp]), idSet
+		id = sequenceType(I.SequenceOf(sp))
+		pos = I.Locate(sp)
+		idSet[id] = pos
+		return int(id), int(pos), idSet, length
 	} else {
-		return -1,-1,idSet
+		return -1,-1,idSet,length
 	}
 }
 
 //-----------------------------------------------------------------------------
 func (I *IndexC) FindGenomeD(query1 []byte, query2 []byte, maxInsert int) map[int]int {
-	id1, pos1, idSet1 := I.regionSearch(query1, 0)
-	id2, pos2, idSet2 := I.regionSearch(query2, 0)
+	return I.findGenomeD(query1, query2, maxInsert, UseMaskedSeeds)
+}
+
+//-----------------------------------------------------------------------------
+// There is a single round, so masked seeds that are down-weighted are used.
+//-----------------------------------------------------------------------------
+func (I *IndexC) findGenomeD(query1 []byte, query2 []byte, maxInsert int, masking SeedMasking) map[int]int {
+	query1, query2 = I.normalizeQuery(query1), I.normalizeQuery(query2)
+	id1, pos1, idSet1, _ := I.maskedRegionSearch(query1, I.seedStart(query1), masking)
+	id2, pos2, idSet2, _ := I.maskedRegionSearch(query2, I.seedStart(query2), masking)
 	out := map[int]int{}
 	// fmt.Println("\t",id1,pos1,idSet1,"\t",id2,pos2,idSet2)
 	if id1==id2 && id1!=-1 && ((pos1>=pos2 && int(pos1-pos2)<=maxInsert)||(pos2>pos1 && int(pos2-pos1)<=maxInsert)) {
@@ -258,22 +617,40 @@ func (I *IndexC) FindGenomeD(query1 []byte, query2 []byte, maxInsert int) map[in
 			}
 		}
 	}
-	return out
+	return I.resolveDecoys(out)
 }
 
 //-----------------------------------------------------------------------------
 func (I *IndexC) FindGenomeR(query1 []byte, query2 []byte, maxInsert int, rounds int) map[int]int {
-	k1, k2 := 0,0	// init round starts from fixed index
+	return I.findGenomeR(query1, query2, maxInsert, rounds, rand.Intn, UseMaskedSeeds)
+}
+
+//-----------------------------------------------------------------------------
+// intn picks the random starting positions of the later rounds, so that
+// concurrent callers can each use their own source of randomness.  A round
+// whose seeds are masked and down-weighted only decides if no later round
+// does.
+//-----------------------------------------------------------------------------
+func (I *IndexC) findGenomeR(query1 []byte, query2 []byte, maxInsert int, rounds int, intn func(int) int, masking SeedMasking) map[int]int {
+	query1, query2 = I.normalizeQuery(query1), I.normalizeQuery(query2)
+	k1, k2 := I.seedStart(query1), I.seedStart(query2) // init round starts from fixed index
 	end := 20
 	regions := map[int]int{}
+	var fallback map[int]int // decided by masked seeds
 	for i:=0; i<rounds; i++ {
-		id1, pos1, idSet1 := I.regionSearch(query1, k1)
-		id2, pos2, idSet2 := I.regionSearch(query2, k2)
+		id1, pos1, idSet1, masked1 := I.maskedRegionSearch(query1, k1, masking)
+		id2, pos2, idSet2, masked2 := I.maskedRegionSearch(query2, k2, masking)
+		masked := masked1 || masked2
 		out := map[int]int{}
 		if id1==id2 && id1!=-1 && ((pos1>=pos2 && int(pos1-pos2)<=maxInsert)||(pos2>pos1 && int(pos2-pos1)<=maxInsert)) {
 			// fmt.Println("1:", pos1, pos2, out)
 			out[int(id1)] = 1
-			return out
+			if !masked {
+				return out
+			}
+			if fallback == nil {
+				fallback = out
+			}
 		} else {
 			for id, p1 := range idSet1 {
 				if p2, ok := idSet2[id]; ok && int(id)!=-1 {
@@ -283,13 +660,25 @@ func (I *IndexC) FindGenomeR(query1 []byte, query2 []byte, maxInsert int, rounds
 					}
 				}
 			}
-			if len(out) == 1 {  // conservative
+			out = I.resolveDecoys(out)
+			if len(out) == 1 && !masked { // conservative
 				// fmt.Println("2:", pos1, pos2, out)
 				return out
 			}
+			if len(out) == 1 && fallback == nil {
+				fallback = out
+			}
+		}
+		// Later rounds start anywhere but in the last end bases, which a
+		// read of at most end bases does not have.
+		if len(query1) <= end || len(query2) <= end {
+			break
 		}
-		k1 = rand.Intn(len(query1)-end)
-		k2 = rand.Intn(len(query2)-end)
+		k1 = intn(len(query1) - end)
+		k2 = intn(len(query2) - end)
+	}
+	if fallback != nil {
+		return fallback
 	}
 	// fail
 	// reg, max := -1, 0
@@ -300,6 +689,18 @@ func (I *IndexC) FindGenomeR(query1 []byte, query2 []byte, maxInsert int, rounds
 	// }
 	// fmt.Println(">>>>Highest count is", reg, max)
 	// fmt.Println(">>>", regions)
+
+	// A pair that only ever hit decoys is reported as such.
+	if I.NUM_DECOYS > 0 && len(regions) > 0 {
+		out := map[int]int{}
+		for id := range regions {
+			if !I.IsDecoy(id) {
+				return map[int]int{}
+			}
+			out[id] = 1
+		}
+		return out
+	}
 	return map[int]int{}
 }
 //-----------------------------------------------------------------------------
@@ -437,48 +838,28 @@ func (I *IndexC) FindGenomeR(query1 []byte, query2 []byte, maxInsert int, rounds
 // 	}
 // }
 
+//-----------------------------------------------------------------------------
+// Read the sequences of a fasta file, which may have any extension and be
+// compressed with gzip or bzip2 (see readFastaRecords).
 //-----------------------------------------------------------------------------
 func (I *IndexC) ReadFasta(file string) {
-	f, err := os.Open(file)
-	check_for_error(err)
-	defer f.Close()
-
-	if file[len(file)-6:] != ".fasta" {
-		panic("ReadFasta:" + file + "is not a fasta file.")
-	}
-
-	scanner := bufio.NewScanner(f)
-	byte_array := make([]byte, 0)
-	i := 0
-	cur_len := 0
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) > 0 {
-			line = bytes.Trim(line, "\n\r ")
-			if line[0] != '>' {
-				byte_array = append(byte_array,line...)
-				cur_len += len(line)
-			} else {
-				items := bytes.SplitN(line[1:], []byte{' '}, 2)
-				I.GENOME_ID = append(I.GENOME_ID, string(items[0]))
-				I.GENOME_DES = append(I.GENOME_DES, string(items[1]))
-				if cur_len != 0 {
-					I.LENS = append(I.LENS, indexType(cur_len))
-				}
-				cur_len = 0
-				if len(byte_array) > 0 {
-					byte_array = append(byte_array, byte('|'))
-				}
-			}
-			i++
+	check_for_error(I.readFasta(context.Background(), file, nil))
+}
+
+//-----------------------------------------------------------------------------
+func (I *IndexC) readFasta(ctx context.Context, file string, progress Progress) error {
+	text := &textBuilder{I: I}
+	err := readFastaRecords(ctx, file, progress, func(id, des string, seq []byte) error {
+		if err := text.add(id, des, seq); err != nil {
+			return errors.New("ReadFasta: " + file + ": " + err.Error())
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	I.LENS = append(I.LENS, indexType(cur_len))
-	// Reverse the sequence
-	for left, right := 0, len(byte_array)-1; left < right; left, right = left+1, right-1 {
-	    byte_array[left], byte_array[right] = byte_array[right], byte_array[left]
-	}
-	I.SEQ = append(byte_array, byte('$'))
+	text.finish()
+	return nil
 }
 
 //-----------------------------------------------------------------------------
@@ -486,11 +867,11 @@ func (I *IndexC) Show() {
 	fmt.Printf(" %6s %6s  OCC\n", "Freq", "C")
 	for i := 0; i < len(I.SYMBOLS); i++ {
 		c := byte(I.SYMBOLS[i])
-		fmt.Printf("%c%6d %6d  %d\n", c, I.Freq[c], I.C[c], I.OCC[c])
+		fmt.Printf("%c%6d %6d  %v\n", c, I.Freq[c], I.C[c], I.OCC[c])
 	}
 	fmt.Printf("SA ")
-	for i := 0; i < len(I.SA); i++ {
-		fmt.Print(I.SA[i], " ")
+	for i := indexType(0); i < I.SA.Len(); i++ {
+		fmt.Print(I.SA.Get(i), " ")
 	}
 	fmt.Printf("\nBWT ")
 	for i := 0; i < len(I.BWT); i++ {
@@ -498,13 +879,13 @@ func (I *IndexC) Show() {
 	}
 	fmt.Println()
 	fmt.Printf("\nSSA ")
-	for i := 0; i < len(I.SSA); i++ {
-		fmt.Printf("%d ", I.SSA[i])
+	for i := indexType(0); i < I.SSA.Len(); i++ {
+		fmt.Printf("%d ", I.SSA.Get(i))
 	}
 	fmt.Println()
 	fmt.Println("SEQ", string(I.SEQ))
-	for i:=0; i<len(I.SA); i++ {
-		fmt.Printf("%4d %s\n", i, string(I.SEQ[I.SA[i]:]))
+	for i := indexType(0); I.SA.Len() > 0 && i < I.LEN; i++ {
+		fmt.Printf("%4d %s\n", i, string(I.SEQ[I.Locate(i):]))
 	}
 }
 
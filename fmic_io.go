@@ -5,21 +5,31 @@
 package fmic
 
 import (
+	"archive/tar"
 	"bufio"
-	"encoding/binary"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 	"sync"
-	"unsafe"
+	"time"
 )
 
+// Every change of the saved format appended a field to the metadata line of
+// "others", so version v has v+5 fields.  From version 8 on, "others" starts
+// with a line "format v"; before, the version is known by its field count.
+const format_version = 10
+
 type Symb_OCC struct {
 	Symb int
-	OCC  []indexType
+	OCC  Ints
 }
 
 //-----------------------------------------------------------------------------
@@ -30,26 +40,113 @@ func check_for_error(e error) {
 }
 
 //-----------------------------------------------------------------------------
-// Save the index to directory.
+// errGroup runs functions concurrently and keeps the first error.
+//-----------------------------------------------------------------------------
+type errGroup struct {
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
 
-func _save_indexType(s []indexType, filename string) {
-	f, err := os.Create(filename)
-	check_for_error(err)
-	defer f.Close()
-	w := bufio.NewWriter(f)
-	err = binary.Write(w, binary.LittleEndian, s)
-	check_for_error(err)
-	w.Flush()
+func (g *errGroup) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.once.Do(func() { g.err = err })
+		}
+	}()
 }
 
-func _save_sequenceType(s []sequenceType, filename string) {
-	f, err := os.Create(filename)
-	check_for_error(err)
-	defer f.Close()
-	w := bufio.NewWriter(f)
-	err = binary.Write(w, binary.LittleEndian, s)
-	check_for_error(err)
-	w.Flush()
+func (g *errGroup) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
+
+//-----------------------------------------------------------------------------
+// indexFile is one file of a saved index, with its size in bytes.
+//-----------------------------------------------------------------------------
+type indexFile struct {
+	name  string
+	size  int64
+	write func(w io.Writer) error
+}
+
+func intsFile(name string, a Ints) indexFile {
+	return indexFile{name, int64(a.Len()) * int64(a.Width), a.write}
+}
+
+func bytesFile(name string, s []byte) indexFile {
+	return indexFile{name, int64(len(s)), func(w io.Writer) error {
+		for len(s) > 0 {
+			n := len(s)
+			if n > check_interval {
+				n = check_interval
+			}
+			if _, err := w.Write(s[:n]); err != nil {
+				return err
+			}
+			s = s[n:]
+		}
+		return nil
+	}}
+}
+
+//-----------------------------------------------------------------------------
+// The files saved with save_option; "others" and "genome_lengths" come first.
+//-----------------------------------------------------------------------------
+func (I *IndexC) indexFiles(save_option int) []indexFile {
+	var others, genome_lengths bytes.Buffer
+	fmt.Fprintf(&others, "format %d\n", format_version)
+	fmt.Fprintf(&others, "%d %d %d %d %t %d %d %d %d %d %t %d %t %s %t\n", I.LEN, I.OCC_SIZE, I.END_POS, I.M, I.Multiple, save_option, I.ISA_RATE, I.NUM_DECOYS, I.SID_WIDTH, I.IDX_WIDTH, I.NO_SSA, I.SA_RATE, I.LCP.Len() > 0, I.ALPHABET, I.MASKS != nil)
+	for i := 0; i < len(I.SYMBOLS); i++ {
+		symb := byte(I.SYMBOLS[i])
+		fmt.Fprintf(&others, "%s %d %d %d\n", string(symb), I.Freq[symb], I.C[symb], I.EP[symb])
+	}
+	for i := 0; i < len(I.GENOME_ID); i++ {
+		fmt.Fprintf(&genome_lengths, "%d %s %s\n", I.LENS[i], I.GENOME_ID[i], I.GENOME_DES[i])
+	}
+
+	files := []indexFile{
+		bytesFile("others", others.Bytes()),
+		bytesFile("genome_lengths", genome_lengths.Bytes()),
+		bytesFile("bwt", I.BWT),
+	}
+	if I.SSA.Len() > 0 {
+		files = append(files, intsFile("ssa", I.SSA))
+	}
+	if save_option == 1 || save_option == 2 {
+		files = append(files, intsFile("sa", I.SA))
+		if I.SA_RATE > 0 {
+			files = append(files, indexFile{"sa_mark", int64(len(I.SA_MARK.words)) * 8, I.SA_MARK.write})
+		}
+	}
+	if I.LCP.Len() > 0 {
+		files = append(files, intsFile("lcp", I.LCP))
+	}
+	if save_option == 2 {
+		files = append(files, bytesFile("seq", I.SEQ))
+	}
+	if I.MASKS != nil {
+		files = append(files, bytesFile("masks", I.masksFile()))
+	}
+	if I.ISA_RATE > 0 {
+		files = append(files, intsFile("isa", I.ISA))
+	}
+	for _, symb := range I.SYMBOLS {
+		files = append(files, intsFile("occ."+string(byte(symb)), I.OCC[byte(symb)]))
+	}
+	return files
+}
+
+func (I *IndexC) checkSaveOption(save_option int) error {
+	if (save_option == 1 || save_option == 2) && I.SA.Len() == 0 {
+		return fmt.Errorf("SaveCompressedIndex: save_option %d needs a suffix array, but the index has none", save_option)
+	}
+	if save_option == 0 && I.NO_SSA {
+		return fmt.Errorf("SaveCompressedIndex: save_option 0 drops the suffix array, which the index needs to find sequences without SSA")
+	}
+	return nil
 }
 
 // ------------------------------------------------------------------
@@ -59,67 +156,124 @@ func _save_sequenceType(s []sequenceType, filename string) {
 //		2 - save both suffix array and seq
 // ------------------------------------------------------------------
 func (I *IndexC) SaveCompressedIndex(save_option int) {
-	dir := I.input_file + ".fmi"
-	os.Mkdir(dir, 0777)
+	check_for_error(I.SaveCompressedIndexContext(context.Background(), save_option, nil))
+}
 
-	var wg sync.WaitGroup
-	wg.Add(len(I.SYMBOLS) + 4)
+// ------------------------------------------------------------------
+// Same as SaveCompressedIndex, but stops writing when ctx is done.
+// ------------------------------------------------------------------
+func (I *IndexC) SaveCompressedIndexContext(ctx context.Context, save_option int, progress Progress) error {
+	dir := I.save_dir
+	if dir == "" {
+		if I.input_file == "" {
+			return errors.New("SaveCompressedIndex: the index has no output directory")
+		}
+		dir = I.input_file + ".fmi"
+	}
+	return I.SaveCompressedIndexTo(ctx, dir, save_option, progress)
+}
 
-	go func() {
-		defer wg.Done()
-		err := ioutil.WriteFile(path.Join(dir, "bwt"), I.BWT, 0666)
-		check_for_error(err)
-	}()
+// ------------------------------------------------------------------
+// Same as SaveCompressedIndexContext, but saves to directory dir.
+// ------------------------------------------------------------------
+func (I *IndexC) SaveCompressedIndexTo(ctx context.Context, dir string, save_option int, progress Progress) error {
+	progress = orNoProgress(progress)
+	progress.Phase(PhaseSave)
+	if err := I.checkSaveOption(save_option); err != nil {
+		return err
+	}
+	os.Mkdir(dir, 0777)
 
-	go func() {
-		defer wg.Done()
-		_save_sequenceType(I.SSA, path.Join(dir, "ssa"))
-	}()
+	var g errGroup
+	for _, file := range I.indexFiles(save_option) {
+		file := file
+		g.Go(func() error {
+			f, err := os.Create(path.Join(dir, file.name))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w := bufio.NewWriter(&ctxWriter{ctx: ctx, w: f})
+			if err = file.write(w); err != nil {
+				return err
+			}
+			return w.Flush()
+		})
+	}
+	return g.Wait()
+}
 
-	go func() {
-		defer wg.Done()
-		if save_option == 1 || save_option == 2 {
-			_save_indexType(I.SA, path.Join(dir, "sa"))
+// ------------------------------------------------------------------
+// Write the files that SaveCompressedIndexTo saves as one tar archive,
+// "others" and "genome_lengths" first, so that ReadIndex can read it from
+// a stream.
+// ------------------------------------------------------------------
+func (I *IndexC) WriteIndex(ctx context.Context, w io.Writer, save_option int, progress Progress) error {
+	progress = orNoProgress(progress)
+	progress.Phase(PhaseSave)
+	if err := I.checkSaveOption(save_option); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(&ctxWriter{ctx: ctx, w: w})
+	tw := tar.NewWriter(bw)
+	for _, file := range I.indexFiles(save_option) {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.name,
+			Size:     file.size,
+			Mode:     0644,
+			ModTime:  time.Unix(0, 0),
 		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		if save_option == 2 {
-			err := ioutil.WriteFile(path.Join(dir, "seq"), I.SEQ, 0666)
-			check_for_error(err)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := file.write(tw); err != nil {
+			return err
 		}
-	}()
-
-	for symb := range I.OCC {
-		go func(symb byte) {
-			defer wg.Done()
-			_save_indexType(I.OCC[symb], path.Join(dir, "occ."+string(symb)))
-		}(symb)
 	}
-
-	f, err := os.Create(path.Join(dir, "others"))
-	check_for_error(err)
-	defer f.Close()
-	w := bufio.NewWriter(f)
-	fmt.Fprintf(w, "%d %d %d %d %t %d\n", I.LEN, I.OCC_SIZE, I.END_POS, I.M, I.Multiple, save_option)
-	for i := 0; i < len(I.SYMBOLS); i++ {
-		symb := byte(I.SYMBOLS[i])
-		fmt.Fprintf(w, "%s %d %d %d\n", string(symb), I.Freq[symb], I.C[symb], I.EP[symb])
+	if err := tw.Close(); err != nil {
+		return err
 	}
-	w.Flush()
+	return bw.Flush()
+}
 
-	// save genome info
-	f, err = os.Create(path.Join(dir, "genome_lengths"))
-	check_for_error(err)
-	defer f.Close()
-	w = bufio.NewWriter(f)
-	for i := 0; i < len(I.GENOME_ID); i++ {
-		fmt.Fprintf(w, "%d %s %s\n", I.LENS[i], I.GENOME_ID[i], I.GENOME_DES[i])
+// ------------------------------------------------------------------
+// Write the index with WriteIndex, with the suffix array and seq if it has
+// them.  It implements io.WriterTo.
+// ------------------------------------------------------------------
+func (I *IndexC) WriteTo(w io.Writer) (int64, error) {
+	save_option := 0
+	if I.SA.Len() > 0 {
+		save_option = 1
+		if len(I.SEQ) > 0 {
+			save_option = 2
+		}
 	}
-	w.Flush()
+	cw := &countWriter{w: w}
+	err := I.WriteIndex(context.Background(), cw, save_option, nil)
+	return cw.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
 
-	wg.Wait()
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+//-----------------------------------------------------------------------------
+// The version of the format the index was loaded from, or of the current
+// format if it was built.
+//-----------------------------------------------------------------------------
+func (I *IndexC) FormatVersion() int {
+	if I.format_version == 0 {
+		return format_version
+	}
+	return I.format_version
 }
 
 // ------------------------------------------------------------------
@@ -129,128 +283,346 @@ func (I *IndexC) SaveCompressedIndex(save_option int) {
 //		2 - both suffix array and seq were saved
 // ------------------------------------------------------------------
 func LoadCompressedIndex(dir string) *IndexC {
+	I, err := LoadCompressedIndexContext(context.Background(), dir, nil)
+	check_for_error(err)
+	return I
+}
+
+// ------------------------------------------------------------------
+// Same as LoadCompressedIndex, but stops reading when ctx is done.
+// ------------------------------------------------------------------
+func LoadCompressedIndexContext(ctx context.Context, dir string, progress Progress) (*IndexC, error) {
+	return loadIndexFiles(ctx, dir, func(name string) (io.ReadCloser, int64, error) {
+		f, err := os.Open(path.Join(dir, name))
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, info.Size(), nil
+	}, progress)
+}
+
+// ------------------------------------------------------------------
+// Same as LoadCompressedIndexContext, but loads directory dir of fsys, such
+// as an embed.FS.  dir is "." for the root of fsys.
+// ------------------------------------------------------------------
+func LoadCompressedIndexFS(ctx context.Context, fsys fs.FS, dir string, progress Progress) (*IndexC, error) {
+	return loadIndexFiles(ctx, dir, func(name string) (io.ReadCloser, int64, error) {
+		f, err := fsys.Open(path.Join(dir, name))
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, info.Size(), nil
+	}, progress)
+}
+
+//-----------------------------------------------------------------------------
+// Load an index with open, which returns a file of the index and its size.
+// dir is only used in errors.
+//-----------------------------------------------------------------------------
+func loadIndexFiles(ctx context.Context, dir string, open func(name string) (io.ReadCloser, int64, error), progress Progress) (*IndexC, error) {
+	progress = orNoProgress(progress)
+	progress.Phase(PhaseLoad)
 	I := new(IndexC)
 
-	// First, load "others"
-	f, err := os.Open(path.Join(dir, "others"))
-	check_for_error(err)
-	defer f.Close()
+	// First, load "others" and "genome_lengths"
+	others, _, err := open("others")
+	if err != nil {
+		return nil, err
+	}
+	defer others.Close()
+	genome_lengths, _, err := open("genome_lengths")
+	if err != nil {
+		return nil, err
+	}
+	defer genome_lengths.Close()
+	loaders, err := I.loadMetadata(ctx, dir, others, genome_lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Second, load Suffix array, BWT and OCC
+	var g errGroup
+	for name, load := range loaders {
+		name, load := name, load
+		g.Go(func() error {
+			f, size, err := open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return load(f, size)
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return nil, err
+	}
+	return I, nil
+}
 
+// ------------------------------------------------------------------
+// Read an index written by WriteTo or WriteIndex.
+// ------------------------------------------------------------------
+func ReadIndex(r io.Reader) (*IndexC, error) {
+	return ReadIndexContext(context.Background(), r, nil)
+}
+
+// ------------------------------------------------------------------
+// Same as ReadIndex, but stops reading when ctx is done.  Files of the
+// archive that are not part of the index are skipped.
+// ------------------------------------------------------------------
+func ReadIndexContext(ctx context.Context, r io.Reader, progress Progress) (*IndexC, error) {
+	progress = orNoProgress(progress)
+	progress.Phase(PhaseLoad)
+	I := new(IndexC)
+	tr := tar.NewReader(bufio.NewReader(&ctxReader{ctx: ctx, r: r, bytesRead: progress.BytesRead}))
+
+	var others, genome_lengths []byte
+	var loaders map[string]func(r io.Reader, size int64) error
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ReadIndex: %v", err)
+		}
+		if loaders == nil {
+			switch hdr.Name {
+			case "others":
+				others, err = ioutil.ReadAll(tr)
+			case "genome_lengths":
+				genome_lengths, err = ioutil.ReadAll(tr)
+			default:
+				return nil, fmt.Errorf("ReadIndex: %s comes before others and genome_lengths", hdr.Name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if others != nil && genome_lengths != nil {
+				loaders, err = I.loadMetadata(ctx, "archive", bytes.NewReader(others), bytes.NewReader(genome_lengths))
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if load, ok := loaders[hdr.Name]; ok {
+			if err = load(tr, hdr.Size); err != nil {
+				return nil, err
+			}
+			delete(loaders, hdr.Name)
+		}
+	}
+	if loaders == nil {
+		return nil, errors.New("ReadIndex: archive has no others or genome_lengths")
+	}
+	for name := range loaders {
+		return nil, fmt.Errorf("ReadIndex: archive has no %s", name)
+	}
+	return I, nil
+}
+
+//-----------------------------------------------------------------------------
+// Read the contents of "others" and "genome_lengths", and return the files
+// left to load, each with a function that reads it from r, which has size
+// bytes.  The functions may run concurrently.
+//-----------------------------------------------------------------------------
+func (I *IndexC) loadMetadata(ctx context.Context, dir string, others, genome_lengths io.Reader) (map[string]func(r io.Reader, size int64) error, error) {
 	var symb byte
 	var freq, c, ep indexType
 	var save_option int
-	scanner := bufio.NewScanner(f)
+	var has_lcp, has_masks bool
+	var alphabet string
+	scanner := bufio.NewScanner(others)
 	scanner.Scan()
-	fmt.Sscanf(scanner.Text(), "%d%d%d%d%t%d\n", &I.LEN, &I.OCC_SIZE, &I.END_POS, &I.M, &I.Multiple, &save_option)
+	line := scanner.Text()
+	if _, err := fmt.Sscanf(line, "format %d", &I.format_version); err == nil {
+		scanner.Scan()
+		line = scanner.Text()
+	} else if I.format_version = len(strings.Fields(line)) - 5; I.format_version >= 8 {
+		return nil, fmt.Errorf("LoadCompressedIndex: %s: others has no format line", dir)
+	}
+	if I.format_version < 1 || I.format_version > format_version {
+		return nil, fmt.Errorf("LoadCompressedIndex: %s has format version %d, but only versions 1 to %d can be read", dir, I.format_version, format_version)
+	}
+	fields := []interface{}{&I.LEN, &I.OCC_SIZE, &I.END_POS, &I.M, &I.Multiple, &save_option, &I.ISA_RATE, &I.NUM_DECOYS, &I.SID_WIDTH, &I.IDX_WIDTH, &I.NO_SSA, &I.SA_RATE, &has_lcp, &alphabet, &has_masks}
+	fields = fields[:I.format_version+5]
+	if n := len(strings.Fields(line)); n != len(fields) {
+		return nil, fmt.Errorf("LoadCompressedIndex: %s: others has %d fields instead of %d for format version %d", dir, n, len(fields), I.format_version)
+	}
+	if _, err := fmt.Sscan(line, fields...); err != nil {
+		return nil, fmt.Errorf("LoadCompressedIndex: %s: others: %v", dir, err)
+	}
+	if I.SID_WIDTH == 0 {
+		I.SID_WIDTH = 2 // indexes saved before SID_WIDTH always used uint16
+	}
+	if I.SID_WIDTH != 2 && I.SID_WIDTH != 4 {
+		return nil, fmt.Errorf("LoadCompressedIndex: %s has %d-byte sequence ids", dir, I.SID_WIDTH)
+	}
+	if I.IDX_WIDTH == 0 {
+		I.IDX_WIDTH = 8 // indexes saved before IDX_WIDTH always used int64
+	}
+	if I.IDX_WIDTH != 4 && I.IDX_WIDTH != 8 {
+		return nil, fmt.Errorf("LoadCompressedIndex: %s has %d-byte indices", dir, I.IDX_WIDTH)
+	}
+	if alphabet != "" {
+		a, err := parseAlphabet(alphabet)
+		if err == nil {
+			err = I.setAlphabet(a)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("LoadCompressedIndex: %s: %v", dir, err)
+		}
+	}
 
 	I.Freq = make(map[byte]indexType)
 	I.C = make(map[byte]indexType)
 	I.EP = make(map[byte]indexType)
 	for scanner.Scan() {
-		fmt.Sscanf(scanner.Text(), "%c%d%d%d", &symb, &freq, &c, &ep)
+		if _, err := fmt.Sscanf(scanner.Text(), "%c%d%d%d", &symb, &freq, &c, &ep); err != nil {
+			return nil, fmt.Errorf("LoadCompressedIndex: %s: others: symbol %q: %v", dir, scanner.Text(), err)
+		}
 		I.SYMBOLS = append(I.SYMBOLS, int(symb))
 		I.Freq[symb], I.C[symb], I.EP[symb] = freq, c, ep
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 
 	// load genome_info
-	f, err = os.Open(path.Join(dir, "genome_lengths"))
-	check_for_error(err)
-	defer f.Close()
-	scanner = bufio.NewScanner(f)
+	scanner = bufio.NewScanner(genome_lengths)
 	var items []string
 	for scanner.Scan() {
 		items = strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 3)
 		cur_len, _ := strconv.Atoi(items[0])
 		I.GENOME_ID = append(I.GENOME_ID, items[1])
-		I.GENOME_DES = append(I.GENOME_ID, items[2])
+		if len(items) == 3 {
+			I.GENOME_DES = append(I.GENOME_DES, items[2])
+		} else {
+			I.GENOME_DES = append(I.GENOME_DES, "")
+		}
 		I.LENS = append(I.LENS, indexType(cur_len))
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := I.checkNumSequences(len(I.LENS)); err != nil {
+		return nil, fmt.Errorf("LoadCompressedIndex: %s: %v", dir, err)
+	}
+	I.computeOffsets()
 
-	// Second, load Suffix array, BWT and OCC
-	I.OCC = make(map[byte][]indexType)
-	var wg sync.WaitGroup
-	wg.Add(len(I.SYMBOLS) + 4)
-
-	go func() {
-		defer wg.Done()
-		I.BWT, err = ioutil.ReadFile(path.Join(dir, "bwt"))
-		check_for_error(err)
-	}()
-
-	go func() {
-		defer wg.Done()
-		I.SSA = _load_sequenceType(path.Join(dir, "ssa"), I.LEN)
-	}()
-
-	go func() {
-		defer wg.Done()
-		if save_option == 1 || save_option == 2 {
-			I.SA = _load_indexType(path.Join(dir, "sa"), I.LEN)
+	loaders := make(map[string]func(r io.Reader, size int64) error)
+	ints := func(name string, a *Ints, width int, length indexType) {
+		loaders[name] = func(r io.Reader, size int64) (err error) {
+			*a, err = _load_ints(ctx, path.Join(dir, name), r, size, width, length)
+			return err
 		}
-	}()
+	}
+	raw := func(name string, s *[]byte) {
+		loaders[name] = func(r io.Reader, size int64) (err error) {
+			*s, err = _load_bytes(ctx, r, size)
+			return err
+		}
+	}
 
-	go func() {
-		defer wg.Done()
-		if save_option == 2 {
-			I.SEQ, err = ioutil.ReadFile(path.Join(dir, "seq"))
-			check_for_error(err)
+	raw("bwt", &I.BWT)
+	if I.Multiple && !I.NO_SSA {
+		ints("ssa", &I.SSA, I.SID_WIDTH, I.LEN)
+	}
+	if save_option == 1 || save_option == 2 {
+		n := I.LEN
+		if I.SA_RATE > 0 {
+			n = (I.LEN-1)/I.SA_RATE + 1
 		}
-	}()
+		ints("sa", &I.SA, I.IDX_WIDTH, n)
+	}
+	if (save_option == 1 || save_option == 2) && I.SA_RATE > 0 {
+		loaders["sa_mark"] = func(r io.Reader, size int64) (err error) {
+			I.SA_MARK, err = _load_bits(ctx, path.Join(dir, "sa_mark"), r, size, I.LEN)
+			return err
+		}
+	}
+	if has_lcp {
+		loaders["lcp"] = func(r io.Reader, size int64) (err error) {
+			if I.LCP, err = _load_ints(ctx, path.Join(dir, "lcp"), r, size, I.IDX_WIDTH, I.LEN); err == nil {
+				I.buildLCPRMQ()
+			}
+			return err
+		}
+	}
+	if save_option == 2 {
+		raw("seq", &I.SEQ)
+	}
+	if has_masks {
+		loaders["masks"] = func(r io.Reader, size int64) error {
+			s, err := _load_bytes(ctx, r, size)
+			if err == nil {
+				err = I.readMasks(s)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", dir, err)
+			}
+			return nil
+		}
+	}
+	if I.ISA_RATE > 0 {
+		ints("isa", &I.ISA, I.IDX_WIDTH, (I.LEN-1)/I.ISA_RATE+1)
+	}
 
-	Symb_OCC_chan := make(chan Symb_OCC)
+	I.OCC = make(map[byte]Ints)
+	var mu sync.Mutex
 	for _, symb := range I.SYMBOLS {
-		go func(symb int) {
-			defer wg.Done()
-			Symb_OCC_chan <- Symb_OCC{symb, _load_indexType(path.Join(dir, "occ."+string(symb)), I.OCC_SIZE)}
-		}(symb)
+		symb := byte(symb)
+		name := "occ." + string(symb)
+		loaders[name] = func(r io.Reader, size int64) error {
+			occ, err := _load_ints(ctx, path.Join(dir, name), r, size, I.IDX_WIDTH, I.OCC_SIZE)
+			if err == nil {
+				mu.Lock()
+				I.OCC[symb] = occ
+				mu.Unlock()
+			}
+			return err
+		}
 	}
-	go func() {
-		wg.Wait()
-		close(Symb_OCC_chan)
-	}()
+	return loaders, nil
+}
 
-	for symb_occ := range Symb_OCC_chan {
-		I.OCC[byte(symb_occ.Symb)] = symb_occ.OCC
-	}
-	return I
+//-----------------------------------------------------------------------------
+func _load_bytes(ctx context.Context, r io.Reader, size int64) ([]byte, error) {
+	s := make([]byte, size)
+	_, err := io.ReadFull(&ctxReader{ctx: ctx, r: r}, s)
+	return s, err
 }
 
 //-----------------------------------------------------------------------------
-func _load_indexType(filename string, length indexType) []indexType {
-	f, err := os.Open(filename)
-	check_for_error(err)
-	defer f.Close()
-	numBytes := uint(unsafe.Sizeof(indexType(0)))
-	v := make([]indexType, length)
-
-	scanner := bufio.NewScanner(f)
-	scanner.Split(bufio.ScanBytes)
-	for i, b := 0, uint(0); scanner.Scan(); b++ {
-		if b == numBytes {
-			b, i = 0, i+1
-		}
-		v[i] += indexType(scanner.Bytes()[0]) << (b * 8)
+// Load length integers of width bytes from the size bytes of r, checking
+// that it has exactly that many.
+//-----------------------------------------------------------------------------
+func _load_ints(ctx context.Context, filename string, r io.Reader, size int64, width int, length indexType) (Ints, error) {
+	if size != int64(length)*int64(width) {
+		return Ints{}, fmt.Errorf("%s has %d bytes instead of %d", filename, size, int64(length)*int64(width))
 	}
-	return v
+	return readInts(bufio.NewReader(&ctxReader{ctx: ctx, r: r}), width, length)
 }
 
 //-----------------------------------------------------------------------------
-func _load_sequenceType(filename string, length indexType) []sequenceType {
-	f, err := os.Open(filename)
-	check_for_error(err)
-	defer f.Close()
-	numBytes := uint(unsafe.Sizeof(sequenceType(0)))
-	v := make([]sequenceType, length)
-
-	scanner := bufio.NewScanner(f)
-	scanner.Split(bufio.ScanBytes)
-	for i, b := 0, uint(0); scanner.Scan(); b++ {
-		if b == numBytes {
-			b, i = 0, i+1
-		}
-		v[i] += sequenceType(scanner.Bytes()[0]) << (b * 8)
+// Load a vector of n bits, checking the size of the file.
+//-----------------------------------------------------------------------------
+func _load_bits(ctx context.Context, filename string, r io.Reader, size int64, n indexType) (BitVector, error) {
+	if size != int64(n+63)/64*8 {
+		return BitVector{}, fmt.Errorf("%s has %d bytes instead of %d", filename, size, int64(n+63)/64*8)
 	}
-	return v
+	return readBitVector(bufio.NewReader(&ctxReader{ctx: ctx, r: r}), n)
 }
 
 //-----------------------------------------------------------------------------
@@ -0,0 +1,168 @@
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Check that L is I as saved with save_option: without the suffix array for
+// 0, and without SEQ unless 2.  Loading sets EP['$'], which building does not.
+func sameSaved(t *testing.T, I, L *IndexC, save_option int) {
+	t.Helper()
+	if _, ok := I.EP['$']; !ok {
+		delete(L.EP, '$')
+	}
+	J := *I
+	if save_option == 0 {
+		J.SA, J.SA_MARK = L.SA, L.SA_MARK
+	}
+	sameIndex(t, &J, L)
+	if (save_option == 2) != (len(L.SEQ) > 0) || save_option == 2 && !bytes.Equal(L.SEQ, I.SEQ) {
+		t.Fatalf("save option %d: SEQ has length %d", save_option, len(L.SEQ))
+	}
+	for k := range I.LENS {
+		if L.GENOME_ID[k] != I.GENOME_ID[k] || L.GENOME_DES[k] != I.GENOME_DES[k] || !bytes.Equal(L.Extract(k, 0, L.LENS[k]), I.Extract(k, 0, I.LENS[k])) {
+			t.Fatalf("save option %d: sequence %d differs", save_option, k)
+		}
+	}
+	if L.LCP.String() != I.LCP.String() {
+		t.Fatalf("save option %d: LCP differs", save_option)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	file := writeFasta(t, []string{randSeq(r, 300), randSeq(r, 1), randSeq(r, 150)})
+	for _, opt := range []BuildOptions{
+		{Multiple: true, CompressionRatio: 4, ISARate: 2},
+		{Multiple: true, CompressionRatio: 4, ISARate: 5, SARate: 3},
+		{Multiple: true, CompressionRatio: 4, ISARate: 3, LCP: true},
+	} {
+		I := buildIndex(t, file, opt)
+		for save_option := 0; save_option <= 2; save_option++ {
+			// A directory, and the same files in an fs.FS.
+			dir := t.TempDir()
+			if err := I.SaveCompressedIndexTo(context.Background(), dir, save_option, nil); err != nil {
+				t.Fatal(err)
+			}
+			L, err := LoadCompressedIndexContext(context.Background(), dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameSaved(t, I, L, save_option)
+			if L, err = LoadCompressedIndexFS(context.Background(), os.DirFS(dir), ".", nil); err != nil {
+				t.Fatal(err)
+			}
+			sameSaved(t, I, L, save_option)
+			m := fstest.MapFS{}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				data, err := os.ReadFile(path.Join(dir, e.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				m["idx/"+e.Name()] = &fstest.MapFile{Data: data}
+			}
+			if L, err = LoadCompressedIndexFS(context.Background(), m, "idx", nil); err != nil {
+				t.Fatal(err)
+			}
+			sameSaved(t, I, L, save_option)
+			delete(m, "idx/bwt")
+			if _, err := LoadCompressedIndexFS(context.Background(), m, "idx", nil); err == nil {
+				t.Error("an index without bwt was loaded")
+			}
+
+			// A tar stream.
+			var buf bytes.Buffer
+			if err := I.WriteIndex(context.Background(), &buf, save_option, nil); err != nil {
+				t.Fatal(err)
+			}
+			if L, err = ReadIndex(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			sameSaved(t, I, L, save_option)
+			if _, err := ReadIndex(bytes.NewReader(buf.Bytes()[:buf.Len()/2])); err == nil {
+				t.Error("half an archive was read")
+			}
+		}
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	I := buildIndex(t, writeFasta(t, []string{randSeq(r, 100), randSeq(r, 50)}), BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 2})
+	var buf bytes.Buffer
+	n, err := I.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("%d of %d bytes written: %v", n, buf.Len(), err)
+	}
+	L, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// WriteTo saves SEQ if the index has it.
+	sameSaved(t, I, L, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := I.WriteIndex(ctx, new(bytes.Buffer), 1, nil); err != context.Canceled {
+		t.Errorf("canceled write: %v", err)
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	file := writeFasta(t, []string{randSeq(r, 70), randSeq(r, 30)})
+	I := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4})
+	dir := t.TempDir()
+	if err := I.SaveCompressedIndexTo(context.Background(), dir, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path.Join(dir, "others"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), "\n", 3)
+	if lines[0] != fmt.Sprintf("format %d", format_version) {
+		t.Fatalf("first line %q", lines[0])
+	}
+	fields := strings.Fields(lines[1])
+	load := func(head ...string) (*IndexC, error) {
+		others := strings.Join(append(head, lines[2]), "\n")
+		if err := os.WriteFile(path.Join(dir, "others"), []byte(others), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return LoadCompressedIndexContext(context.Background(), dir, nil)
+	}
+
+	// Before version 8, the version is the number of fields minus 5.
+	L, err := load(strings.Join(fields[:12], " "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if L.FormatVersion() != 7 || L.LEN != I.LEN || L.SA_RATE != 0 {
+		t.Errorf("version %d, LEN %d", L.FormatVersion(), L.LEN)
+	}
+	for _, head := range [][]string{
+		{strings.Join(fields, " ")},
+		{lines[0], strings.Join(fields[:12], " ")},
+		{lines[0], strings.Join(append(fields, "7"), " ")},
+		{lines[0], strings.Replace(lines[1], "true", "yes", 1)},
+		{fmt.Sprintf("format %d", format_version+1), lines[1]},
+		{"format 0", ""},
+	} {
+		if _, err := load(head...); err == nil {
+			t.Errorf("%q: no error", head)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func randSeq(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = "ACGT"[r.Intn(4)]
+	}
+	return string(b)
+}
+
+// Write recs as t0, t1, ... to a fasta file in a temporary directory.
+func writeFasta(t *testing.T, recs []string) string {
+	t.Helper()
+	var sb strings.Builder
+	for k, rec := range recs {
+		sb.WriteString(">t" + strconv.Itoa(k) + " desc\n" + rec + "\n")
+	}
+	file := filepath.Join(t.TempDir(), "ref.fasta")
+	if err := os.WriteFile(file, []byte(sb.String()), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func buildIndex(t *testing.T, file string, opt BuildOptions) *IndexC {
+	t.Helper()
+	I, err := CompressedIndexContext(context.Background(), file, opt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return I
+}
+
+func sameIndex(t *testing.T, I, J *IndexC) {
+	t.Helper()
+	if !bytes.Equal(I.BWT, J.BWT) || I.END_POS != J.END_POS {
+		t.Fatal("BWTs differ")
+	}
+	if !reflect.DeepEqual(I.Freq, J.Freq) || !reflect.DeepEqual(I.C, J.C) || !reflect.DeepEqual(I.EP, J.EP) {
+		t.Fatal("count tables differ")
+	}
+	if !reflect.DeepEqual(I.SA, J.SA) || !reflect.DeepEqual(I.SSA, J.SSA) || !reflect.DeepEqual(I.ISA, J.ISA) {
+		t.Fatal("SA, SSA or ISA differ")
+	}
+	if !reflect.DeepEqual(I.OCC, J.OCC) {
+		t.Fatal("occurences differ")
+	}
+}
+
+func TestSequenceOfWithoutSSA(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	recs := []string{randSeq(r, 300), randSeq(r, 1), randSeq(r, 500), randSeq(r, 40)}
+	file := writeFasta(t, recs)
+	I := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4})
+	J := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4, NoSSA: true})
+	if J.SSA.Len() != 0 {
+		t.Fatal("SSA was built")
+	}
+	if err := J.SaveCompressedIndexContext(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	L, err := LoadCompressedIndexContext(context.Background(), file+".fmi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := indexType(0); i < I.LEN; i++ {
+		if k := I.SequenceOf(i); J.SequenceOf(i) != k || L.SequenceOf(i) != k {
+			t.Fatalf("row %d (%q) is in sequence %d, %d without SSA, %d loaded", i, I.SEQ[I.SA.Get(i)], k, J.SequenceOf(i), L.SequenceOf(i))
+		}
+	}
+	if err := J.SaveCompressedIndexContext(context.Background(), 0, nil); err == nil {
+		t.Error("an index without SSA was saved without its suffix array")
+	}
+}
+
+// The suffix array of text by sorting its suffixes; a suffix comes before
+// the longer suffixes that it is a prefix of.
+func naiveSuffixArray(text []int) []int {
+	SA := make([]int, len(text))
+	for i := range SA {
+		SA[i] = i
+	}
+	sort.Slice(SA, func(a, b int) bool {
+		x, y := text[SA[a]:], text[SA[b]:]
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if x[i] != y[i] {
+				return x[i] < y[i]
+			}
+		}
+		return len(x) < len(y)
+	})
+	return SA
+}
+
+func TestBuildWithoutSA(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	file := writeFasta(t, []string{randSeq(r, 400), randSeq(r, 3), randSeq(r, 250)})
+	I := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4})
+	text := make([]int, len(I.SEQ))
+	for i, c := range I.SEQ {
+		text[i] = int(c)
+	}
+	SA := naiveSuffixArray(text)
+	for _, opt := range []BuildOptions{
+		{Multiple: true, CompressionRatio: 4},
+		{Multiple: true, CompressionRatio: 4, NoSA: true, ISARate: 4},
+		{Multiple: true, CompressionRatio: 4, NoSA: true, MemoryBudget: 100},
+		{Multiple: true, CompressionRatio: 4, SARate: 3},
+	} {
+		J := buildIndex(t, file, opt)
+		for i, p := range SA {
+			c := I.SEQ[len(I.SEQ)-1]
+			if p > 0 {
+				c = I.SEQ[p-1]
+			}
+			if J.BWT[i] != c {
+				t.Fatalf("%+v: row %d of the BWT is %q instead of %q", opt, i, J.BWT[i], c)
+			}
+		}
+		if opt.NoSA && J.SA.Len() != 0 {
+			t.Errorf("%+v: the suffix array was kept", opt)
+		}
+		if !opt.NoSA && opt.SARate == 0 {
+			for i, p := range SA {
+				if J.SA.Get(indexType(i)) != indexType(p) {
+					t.Fatalf("%+v: SA[%d] is %d instead of %d", opt, i, J.SA.Get(indexType(i)), p)
+				}
+			}
+		}
+		if opt.NoSA && J.SaveCompressedIndexContext(context.Background(), 1, nil) == nil {
+			t.Errorf("%+v: saved with save_option 1", opt)
+		}
+		verifyOK(t, J)
+	}
+	opt := BuildOptions{Multiple: true, CompressionRatio: 4, NoSA: true, NoSSA: true}
+	if _, err := CompressedIndexContext(context.Background(), file, opt, nil); err == nil {
+		t.Errorf("%+v: no error", opt)
+	}
+}
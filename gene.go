@@ -0,0 +1,85 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Gene-level aggregation of transcript abundances.
+*/
+package fmic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Gene-level abundances, summarized from transcripts the way tximport does.
+type GeneAbundance struct {
+	IDs      []string
+	Length   []float64 // abundance-weighted mean of the effective lengths
+	NumReads []float64
+	TPM      []float64
+	Unmapped []string // sequence ids with no gene in the map
+}
+
+//-----------------------------------------------------------------------------
+// Sum the estimated counts and TPM of the transcripts of each gene.  The gene
+// length is the TPM-weighted mean of the effective lengths of its transcripts,
+// or their plain mean if the gene is not expressed.
+//-----------------------------------------------------------------------------
+func (A *Abundance) SummarizeToGene(tx2gene Tx2Gene) *GeneAbundance {
+	G := &GeneAbundance{}
+	members := make(map[string][]int)
+	for k, id := range A.IDs {
+		gid, ok := tx2gene.Lookup(id)
+		if !ok {
+			G.Unmapped = append(G.Unmapped, id)
+			continue
+		}
+		if _, ok = members[gid]; !ok {
+			G.IDs = append(G.IDs, gid)
+		}
+		members[gid] = append(members[gid], k)
+	}
+	sort.Strings(G.IDs)
+
+	G.Length = make([]float64, len(G.IDs))
+	G.NumReads = make([]float64, len(G.IDs))
+	G.TPM = make([]float64, len(G.IDs))
+	for g, gid := range G.IDs {
+		weighted_len, mean_len := 0.0, 0.0
+		for _, k := range members[gid] {
+			G.NumReads[g] += A.NumReads[k]
+			G.TPM[g] += A.TPM[k]
+			weighted_len += A.TPM[k] * A.EffLength[k]
+			mean_len += A.EffLength[k]
+		}
+		if G.TPM[g] > 0 {
+			G.Length[g] = weighted_len / G.TPM[g]
+		} else {
+			G.Length[g] = mean_len / float64(len(members[gid]))
+		}
+	}
+	return G
+}
+
+//-----------------------------------------------------------------------------
+func (G *GeneAbundance) WriteTSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Name\tLength\tNumReads\tTPM\n")
+	for g, gid := range G.IDs {
+		fmt.Fprintf(bw, "%s\t%.3f\t%.3f\t%.6f\n", gid, G.Length[g], G.NumReads[g], G.TPM[g])
+	}
+	return bw.Flush()
+}
+
+//-----------------------------------------------------------------------------
+// Write the sequence ids that have no gene, one per line.
+//-----------------------------------------------------------------------------
+func (G *GeneAbundance) WriteUnmapped(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, id := range G.Unmapped {
+		fmt.Fprintf(bw, "%s\n", id)
+	}
+	return bw.Flush()
+}
+
+//-----------------------------------------------------------------------------
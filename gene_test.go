@@ -0,0 +1,83 @@
+package fmic
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeToGene(t *testing.T) {
+	A := &Abundance{
+		IDs:       []string{"t1", "t2|g|x", "t3", "t4"},
+		EffLength: []float64{100, 300, 50, 80},
+		NumReads:  []float64{10, 30, 0, 5},
+		TPM:       []float64{3e5, 1e5, 0, 6e5},
+	}
+	dir := t.TempDir()
+	gtf := filepath.Join(dir, "a.gtf")
+	os.WriteFile(gtf, []byte(
+		"chr1\tsrc\ttranscript\t1\t100\t.\t+\t.\tgene_id \"gA\"; transcript_id \"t1\";\n"+
+			"chr1\tsrc\texon\t1\t100\t.\t+\t.\tgene_id \"gA\"; transcript_id \"t1\";\n"+
+			"chr1\tsrc\ttranscript\t1\t300\t.\t+\t.\tgene_id \"gA\"; transcript_id \"t2\";\n"+
+			"chr2\tsrc\ttranscript\t1\t50\t.\t-\t.\tgene_id \"gB\"; transcript_id \"t3\";\n"), 0666)
+	table := filepath.Join(dir, "tx2gene.tsv")
+	os.WriteFile(table, []byte("# transcript gene\nt1\tgA\nt2\tgA\nt3 gB\n"), 0666)
+
+	for k, file := range []string{gtf, table} {
+		var tx2gene Tx2Gene
+		var err error
+		if k == 0 {
+			tx2gene, err = ReadTx2GeneGTF(file)
+		} else {
+			tx2gene, err = ReadTx2Gene(file)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		G := A.SummarizeToGene(tx2gene)
+		if len(G.IDs) != 2 || G.IDs[0] != "gA" || G.IDs[1] != "gB" {
+			t.Fatalf("%s: genes %v", file, G.IDs)
+		}
+		if G.NumReads[0] != 40 || G.TPM[0] != 4e5 || math.Abs(G.Length[0]-150) > 1e-9 {
+			t.Errorf("%s: gA has %v reads, %v TPM and length %v", file, G.NumReads[0], G.TPM[0], G.Length[0])
+		}
+		// gB is not expressed, so its length is the plain mean.
+		if G.NumReads[1] != 0 || G.Length[1] != 50 {
+			t.Errorf("%s: gB has %v reads and length %v", file, G.NumReads[1], G.Length[1])
+		}
+
+		var tsv, unmapped bytes.Buffer
+		if err := G.WriteTSV(&tsv); err != nil {
+			t.Fatal(err)
+		}
+		want := "Name\tLength\tNumReads\tTPM\ngA\t150.000\t40.000\t400000.000000\ngB\t50.000\t0.000\t0.000000\n"
+		if tsv.String() != want {
+			t.Errorf("%s: WriteTSV wrote\n%s", file, tsv.String())
+		}
+		if err := G.WriteUnmapped(&unmapped); err != nil {
+			t.Fatal(err)
+		}
+		if unmapped.String() != "t4\n" {
+			t.Errorf("%s: WriteUnmapped wrote %q", file, unmapped.String())
+		}
+	}
+}
+
+func TestReadGTFErrors(t *testing.T) {
+	attr := "\tgene_id \"g\"; transcript_id \"t\";\n"
+	for gtf, want := range map[string]string{
+		"chr1\ts\texon\t1\t9\t.\t+\t.":                       "ReadGTF: line 1 has 8 columns instead of 9",
+		"# x\nchr1\ts\texon\t1\t9\t.\t\t." + attr:            "ReadGTF: line 2: invalid strand \"\"",
+		"chr1\ts\texon\t1\t9\t.\t+-\t." + attr:               "ReadGTF: line 1: invalid strand \"+-\"",
+		"chr1\ts\texon\tx\t9\t.\t+\t." + attr:                "ReadGTF: line 1: strconv.Atoi: parsing \"x\": invalid syntax",
+		"chr1\ts\texon\t1\t9\t.\t?\t." + attr + "\nchr\t9\n": "ReadGTF: line 3 has 2 columns instead of 9",
+	} {
+		err := ReadGTF(strings.NewReader(gtf), func(rec *GTFRecord) error { return nil })
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: %v", gtf, err)
+		}
+	}
+}
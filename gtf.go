@@ -0,0 +1,169 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Reading of GTF/GFF3 annotations and tx2gene tables.
+*/
+package fmic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// One line of a GTF or GFF3 file.  Start and End are 1-based and inclusive.
+type GTFRecord struct {
+	Seqname string
+	Feature string
+	Start   int
+	End     int
+	Strand  byte
+	Attr    map[string]string
+}
+
+// Tx2Gene maps sequence (transcript) ids to gene ids.
+type Tx2Gene map[string]string
+
+//-----------------------------------------------------------------------------
+// Call f on every feature of a GTF or GFF3 file.  The attribute syntax
+// (key "value"; or key=value;) is detected on each line.
+//-----------------------------------------------------------------------------
+func ReadGTF(r io.Reader, f func(rec *GTFRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	line_num := 0
+	for scanner.Scan() {
+		line_num++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		items := strings.Split(line, "\t")
+		if len(items) < 9 {
+			return fmt.Errorf("ReadGTF: line %d has %d columns instead of 9", line_num, len(items))
+		}
+		if len(items[6]) != 1 || !strings.Contains("+-.?", items[6]) {
+			return fmt.Errorf("ReadGTF: line %d: invalid strand %q", line_num, items[6])
+		}
+		rec := &GTFRecord{Seqname: items[0], Feature: items[2], Strand: items[6][0]}
+		var err error
+		if rec.Start, err = strconv.Atoi(items[3]); err != nil {
+			return fmt.Errorf("ReadGTF: line %d: %v", line_num, err)
+		}
+		if rec.End, err = strconv.Atoi(items[4]); err != nil {
+			return fmt.Errorf("ReadGTF: line %d: %v", line_num, err)
+		}
+		rec.Attr = parseAttributes(items[8])
+		if err = f(rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+//-----------------------------------------------------------------------------
+func parseAttributes(s string) map[string]string {
+	attr := make(map[string]string)
+	for _, field := range strings.Split(s, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		var key, value string
+		if i := strings.IndexByte(field, '='); i >= 0 && !strings.Contains(field[:i], " ") {
+			key, value = field[:i], field[i+1:] // GFF3
+		} else if i := strings.IndexByte(field, ' '); i >= 0 {
+			key, value = field[:i], strings.Trim(strings.TrimSpace(field[i+1:]), "\"") // GTF
+		} else {
+			continue
+		}
+		if _, ok := attr[key]; !ok {
+			attr[key] = value
+		}
+	}
+	return attr
+}
+
+//-----------------------------------------------------------------------------
+// Returns the transcript and gene ids of a feature, without the "transcript:"
+// and "gene:" prefixes used by Ensembl GFF3 files.
+//-----------------------------------------------------------------------------
+func (rec *GTFRecord) TranscriptGene() (string, string) {
+	if tid, ok := rec.Attr["transcript_id"]; ok {
+		return tid, rec.Attr["gene_id"]
+	}
+	switch rec.Feature {
+	case "exon", "CDS", "five_prime_UTR", "three_prime_UTR", "start_codon", "stop_codon":
+		return "", ""
+	}
+	id, parent := rec.Attr["ID"], rec.Attr["Parent"]
+	if id == "" || parent == "" || !strings.HasPrefix(parent, "gene:") && strings.Contains(parent, ":") {
+		return "", ""
+	}
+	return strings.TrimPrefix(id, "transcript:"), strings.TrimPrefix(parent, "gene:")
+}
+
+//-----------------------------------------------------------------------------
+// Map transcripts to genes using a GTF or GFF3 annotation.
+//-----------------------------------------------------------------------------
+func ReadTx2GeneGTF(file string) (Tx2Gene, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tx2gene := make(Tx2Gene)
+	err = ReadGTF(f, func(rec *GTFRecord) error {
+		if tid, gid := rec.TranscriptGene(); tid != "" && gid != "" {
+			tx2gene[tid] = gid
+		}
+		return nil
+	})
+	return tx2gene, err
+}
+
+//-----------------------------------------------------------------------------
+// Map transcripts to genes using a table whose first two columns are the
+// transcript and gene ids, separated by tabs or spaces.
+//-----------------------------------------------------------------------------
+func ReadTx2Gene(file string) (Tx2Gene, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tx2gene := make(Tx2Gene)
+	scanner := bufio.NewScanner(f)
+	line_num := 0
+	for scanner.Scan() {
+		line_num++
+		items := strings.Fields(scanner.Text())
+		if len(items) == 0 || items[0][0] == '#' {
+			continue
+		}
+		if len(items) < 2 {
+			return nil, fmt.Errorf("ReadTx2Gene: line %d has no gene id", line_num)
+		}
+		tx2gene[items[0]] = items[1]
+	}
+	return tx2gene, scanner.Err()
+}
+
+//-----------------------------------------------------------------------------
+// Returns the gene of sequence id.  GENCODE fasta ids, which hold several
+// '|'-separated fields, are looked up by their first field.
+//-----------------------------------------------------------------------------
+func (tx2gene Tx2Gene) Lookup(id string) (string, bool) {
+	if gid, ok := tx2gene[id]; ok {
+		return gid, true
+	}
+	if i := strings.IndexByte(id, '|'); i >= 0 {
+		gid, ok := tx2gene[id[:i]]
+		return gid, ok
+	}
+	return "", false
+}
+
+//-----------------------------------------------------------------------------
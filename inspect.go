@@ -0,0 +1,175 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Summary statistics of an index.
+*/
+package fmic
+
+import (
+	"os"
+	"path"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+// A summary of an index, with JSON field names for pipelines.
+//-----------------------------------------------------------------------------
+type IndexStats struct {
+	FormatVersion    int              `json:"format_version"`
+	Records          int              `json:"records"`
+	Decoys           int              `json:"decoys"`
+	TotalLength      int64            `json:"total_length"` // of the records
+	TextLength       int64            `json:"text_length"`  // with separators and '$'
+	MaskedLength     int64            `json:"masked_length"`
+	Lengths          LengthStats      `json:"lengths"`
+	Largest          []RecordStats    `json:"largest"`
+	Smallest         []RecordStats    `json:"smallest"`
+	Frequencies      map[string]int64 `json:"symbol_frequencies"`
+	CompressionRatio int              `json:"compression_ratio"` // M
+	SARate           int64            `json:"sa_rate"`
+	ISARate          int64            `json:"isa_rate"`
+	IndexWidth       int              `json:"index_width"`
+	SequenceIDWidth  int              `json:"sequence_id_width"`
+	Alphabet         string           `json:"alphabet"`
+	Components       []ComponentStats `json:"components"`
+}
+
+// The distribution of the lengths of the records.
+type LengthStats struct {
+	Min    int64   `json:"min"`
+	P25    int64   `json:"p25"`
+	Median int64   `json:"median"`
+	P75    int64   `json:"p75"`
+	Max    int64   `json:"max"`
+	Mean   float64 `json:"mean"`
+	N50    int64   `json:"n50"`
+}
+
+type RecordStats struct {
+	Name   string `json:"name"`
+	Length int64  `json:"length"`
+}
+
+// One part of the index, and the files it is saved in.
+type ComponentStats struct {
+	Name        string `json:"name"`
+	Present     bool   `json:"present"`
+	MemoryBytes int64  `json:"memory_bytes"`
+	DiskBytes   int64  `json:"disk_bytes"`
+}
+
+//-----------------------------------------------------------------------------
+// Summarize the index, with the top largest and smallest records.  If dir is
+// not empty, the disk size of each component is that of its files in dir.
+//-----------------------------------------------------------------------------
+func (I *IndexC) Stats(dir string, top int) (*IndexStats, error) {
+	s := &IndexStats{
+		FormatVersion:    I.FormatVersion(),
+		Records:          len(I.LENS),
+		Decoys:           I.NUM_DECOYS,
+		TextLength:       int64(I.LEN),
+		Frequencies:      make(map[string]int64),
+		CompressionRatio: I.M,
+		SARate:           int64(I.SA_RATE),
+		ISARate:          int64(I.ISA_RATE),
+		IndexWidth:       I.IDX_WIDTH,
+		SequenceIDWidth:  I.SID_WIDTH,
+		Alphabet:         I.ALPHABET.String(),
+	}
+	for _, symb := range I.SYMBOLS {
+		s.Frequencies[string(byte(symb))] = int64(I.Freq[byte(symb)])
+	}
+
+	// Records in increasing order of length.
+	order := make([]int, len(I.LENS))
+	for k := range order {
+		order[k] = k
+		s.TotalLength += int64(I.LENS[k])
+	}
+	sort.SliceStable(order, func(a, b int) bool { return I.LENS[order[a]] < I.LENS[order[b]] })
+	if n := len(order); n > 0 {
+		length := func(q float64) int64 { return int64(I.LENS[order[int(q*float64(n-1))]]) }
+		s.Lengths = LengthStats{
+			Min:    length(0),
+			P25:    length(0.25),
+			Median: length(0.5),
+			P75:    length(0.75),
+			Max:    length(1),
+			Mean:   float64(s.TotalLength) / float64(n),
+		}
+		// N50: the length of the record at which the longest records reach
+		// half of the total length.
+		var sum int64
+		for j := n - 1; j >= 0; j-- {
+			sum += int64(I.LENS[order[j]])
+			if 2*sum >= s.TotalLength {
+				s.Lengths.N50 = int64(I.LENS[order[j]])
+				break
+			}
+		}
+	}
+	for j := 0; j < top && j < len(order); j++ {
+		small, large := order[j], order[len(order)-1-j]
+		s.Smallest = append(s.Smallest, RecordStats{I.GENOME_ID[small], int64(I.LENS[small])})
+		s.Largest = append(s.Largest, RecordStats{I.GENOME_ID[large], int64(I.LENS[large])})
+	}
+
+	ints := func(a Ints) int64 { return int64(a.Len()) * int64(a.Width) }
+	var occ int64
+	var occ_files []string
+	for _, symb := range I.SYMBOLS {
+		occ += ints(I.OCC[byte(symb)])
+		occ_files = append(occ_files, "occ."+string(byte(symb)))
+	}
+	var rmq int64
+	for _, level := range I.lcp_rmq {
+		rmq += int64(len(level)) * 8
+	}
+	var metadata int64
+	for _, id := range I.GENOME_ID {
+		metadata += int64(len(id))
+	}
+	for _, des := range I.GENOME_DES {
+		metadata += int64(len(des))
+	}
+	metadata += int64(len(I.LENS)+len(I.offsets)) * 8
+	var masks int64
+	for _, m := range I.MASKS {
+		masks += int64(len(m)) * 16
+		for _, interval := range m {
+			s.MaskedLength += int64(interval.End - interval.Start)
+		}
+	}
+	components := []struct {
+		stats ComponentStats
+		files []string
+	}{
+		{ComponentStats{Name: "bwt", Present: len(I.BWT) > 0, MemoryBytes: int64(len(I.BWT))}, []string{"bwt"}},
+		{ComponentStats{Name: "occ", Present: len(I.OCC) > 0, MemoryBytes: occ}, occ_files},
+		{ComponentStats{Name: "sa", Present: I.SA.Len() > 0, MemoryBytes: ints(I.SA)}, []string{"sa"}},
+		{ComponentStats{Name: "sa_mark", Present: I.SA_MARK.N > 0, MemoryBytes: int64(len(I.SA_MARK.words)+len(I.SA_MARK.ranks)) * 8}, []string{"sa_mark"}},
+		{ComponentStats{Name: "ssa", Present: I.SSA.Len() > 0, MemoryBytes: ints(I.SSA)}, []string{"ssa"}},
+		{ComponentStats{Name: "isa", Present: I.ISA.Len() > 0, MemoryBytes: ints(I.ISA)}, []string{"isa"}},
+		{ComponentStats{Name: "lcp", Present: I.LCP.Len() > 0, MemoryBytes: ints(I.LCP) + rmq}, []string{"lcp"}},
+		{ComponentStats{Name: "seq", Present: len(I.SEQ) > 0, MemoryBytes: int64(len(I.SEQ))}, []string{"seq"}},
+		{ComponentStats{Name: "masks", Present: I.MASKS != nil, MemoryBytes: masks}, []string{"masks"}},
+		{ComponentStats{Name: "metadata", Present: true, MemoryBytes: metadata}, []string{"others", "genome_lengths"}},
+	}
+	for _, c := range components {
+		if dir != "" {
+			for _, file := range c.files {
+				info, err := os.Stat(path.Join(dir, file))
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				c.stats.DiskBytes += info.Size()
+			}
+		}
+		s.Components = append(s.Components, c.stats)
+	}
+	return s, nil
+}
+
+//-----------------------------------------------------------------------------
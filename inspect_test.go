@@ -0,0 +1,74 @@
+package fmic
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	recs := []string{randSeq(r, 30), randSeq(r, 100), randSeq(r, 10), randSeq(r, 40), randSeq(r, 20)}
+	I := buildIndex(t, writeFasta(t, recs), BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 3, LCP: true})
+	dir := t.TempDir()
+	if err := I.SaveCompressedIndexTo(context.Background(), dir, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	s, err := I.Stats(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Records != 5 || s.Decoys != 0 || s.TotalLength != 200 || s.TextLength != 205 || s.MaskedLength != 0 || s.FormatVersion != format_version || s.ISARate != 3 {
+		t.Fatalf("%+v", s)
+	}
+	if want := (LengthStats{Min: 10, P25: 20, Median: 30, P75: 40, Max: 100, Mean: 40, N50: 100}); s.Lengths != want {
+		t.Fatalf("lengths %+v, want %+v", s.Lengths, want)
+	}
+	if !reflect.DeepEqual(s.Smallest, []RecordStats{{"t2", 10}, {"t4", 20}}) || !reflect.DeepEqual(s.Largest, []RecordStats{{"t1", 100}, {"t3", 40}}) {
+		t.Fatalf("smallest %v, largest %v", s.Smallest, s.Largest)
+	}
+	var freq int64
+	for _, c := range "ACGT" {
+		freq += s.Frequencies[string(c)]
+	}
+	if freq != 200 {
+		t.Fatalf("frequencies %v", s.Frequencies)
+	}
+
+	// Save option 1 leaves SEQ out; the disk size is that of the files.
+	for _, c := range s.Components {
+		size := func(file string) int64 {
+			info, err := os.Stat(path.Join(dir, file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return info.Size()
+		}
+		switch c.Name {
+		case "bwt", "sa", "lcp", "isa":
+			if !c.Present || c.MemoryBytes <= 0 || c.DiskBytes != size(c.Name) {
+				t.Errorf("%+v", c)
+			}
+		case "seq", "masks":
+			if c.DiskBytes != 0 {
+				t.Errorf("%+v", c)
+			}
+		}
+	}
+
+	// Without a directory, nothing is on disk.
+	if s, err = I.Stats("", 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Largest) != 5 || s.Largest[4] != (RecordStats{"t2", 10}) {
+		t.Fatalf("largest %v", s.Largest)
+	}
+	for _, c := range s.Components {
+		if c.DiskBytes != 0 {
+			t.Errorf("%+v", c)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Integer arrays whose width is chosen at run time.
+*/
+package fmic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+//-----------------------------------------------------------------------------
+// Ints is an array of non-negative integers, each stored in Width bytes
+// (2, 4 or 8).
+//-----------------------------------------------------------------------------
+type Ints struct {
+	Width int
+	u16   []uint16
+	u32   []uint32
+	u64   []uint64
+}
+
+//-----------------------------------------------------------------------------
+func NewInts(width int, n indexType) Ints {
+	a := Ints{Width: width}
+	switch width {
+	case 2:
+		a.u16 = make([]uint16, n)
+	case 4:
+		a.u32 = make([]uint32, n)
+	case 8:
+		a.u64 = make([]uint64, n)
+	default:
+		panic(fmt.Sprintf("NewInts: unsupported width %d", width))
+	}
+	return a
+}
+
+//-----------------------------------------------------------------------------
+// Largest value that can be stored in width bytes.
+//-----------------------------------------------------------------------------
+func maxIntsValue(width int) uint64 {
+	if width >= 8 {
+		return 1<<63 - 1
+	}
+	return 1<<(8*uint(width)) - 1
+}
+
+//-----------------------------------------------------------------------------
+func (a Ints) Len() indexType {
+	switch a.Width {
+	case 2:
+		return indexType(len(a.u16))
+	case 4:
+		return indexType(len(a.u32))
+	case 8:
+		return indexType(len(a.u64))
+	}
+	return 0
+}
+
+//-----------------------------------------------------------------------------
+func (a Ints) Get(i indexType) indexType {
+	switch a.Width {
+	case 2:
+		return indexType(a.u16[i])
+	case 4:
+		return indexType(a.u32[i])
+	default:
+		return indexType(a.u64[i])
+	}
+}
+
+//-----------------------------------------------------------------------------
+func (a Ints) Set(i, v indexType) {
+	switch a.Width {
+	case 2:
+		a.u16[i] = uint16(v)
+	case 4:
+		a.u32[i] = uint32(v)
+	default:
+		a.u64[i] = uint64(v)
+	}
+}
+
+//-----------------------------------------------------------------------------
+func (a Ints) String() string {
+	return fmt.Sprint(a.slice(0, a.Len()))
+}
+
+//-----------------------------------------------------------------------------
+// The underlying slice of a[i:j], for encoding/binary.
+//-----------------------------------------------------------------------------
+func (a Ints) slice(i, j indexType) interface{} {
+	switch a.Width {
+	case 2:
+		return a.u16[i:j]
+	case 4:
+		return a.u32[i:j]
+	default:
+		return a.u64[i:j]
+	}
+}
+
+// Number of values encoded or decoded at once.
+const ints_chunk = 1 << 16
+
+//-----------------------------------------------------------------------------
+// Write the values in little endian.
+//-----------------------------------------------------------------------------
+func (a Ints) write(w io.Writer) error {
+	n := a.Len()
+	for i := indexType(0); i < n; i += ints_chunk {
+		j := i + ints_chunk
+		if j > n {
+			j = n
+		}
+		if err := binary.Write(w, binary.LittleEndian, a.slice(i, j)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Read n values of width bytes written by write.
+//-----------------------------------------------------------------------------
+func readInts(r io.Reader, width int, n indexType) (Ints, error) {
+	if width != 2 && width != 4 && width != 8 {
+		return Ints{}, fmt.Errorf("readInts: unsupported width %d", width)
+	}
+	a := NewInts(width, n)
+	for i := indexType(0); i < n; i += ints_chunk {
+		j := i + ints_chunk
+		if j > n {
+			j = n
+		}
+		if err := binary.Read(r, binary.LittleEndian, a.slice(i, j)); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,116 @@
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestInts(t *testing.T) {
+	for _, width := range []int{2, 4, 8} {
+		n := indexType(ints_chunk + 5)
+		a := NewInts(width, n)
+		for i := indexType(0); i < n; i++ {
+			a.Set(i, indexType(uint64(i)*7919%(maxIntsValue(width)+1)))
+		}
+		a.Set(n-1, indexType(maxIntsValue(width)))
+		var buf bytes.Buffer
+		if err := a.write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != int(n)*width {
+			t.Fatalf("%d values of width %d written in %d bytes", n, width, buf.Len())
+		}
+		b, err := readInts(&buf, width, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a, b) || b.Get(n-1) != indexType(maxIntsValue(width)) {
+			t.Errorf("width %d: values differ after reading", width)
+		}
+	}
+	if _, err := readInts(new(bytes.Buffer), 3, 1); err == nil {
+		t.Error("3-byte values were read")
+	}
+	if _, err := readInts(bytes.NewReader(make([]byte, 7)), 4, 2); err == nil {
+		t.Error("2 values of 4 bytes were read from 7 bytes")
+	}
+}
+
+func TestManySequences(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	recs := make([]string, 70000)
+	for k := range recs {
+		recs[k] = randSeq(r, 1+r.Intn(3))
+	}
+	file := writeFasta(t, recs)
+	if _, err := CompressedIndexContext(context.Background(), file, BuildOptions{Multiple: true, CompressionRatio: 4, SIDWidth: 2}, nil); err == nil {
+		t.Error("70000 sequences were given 2-byte ids")
+	}
+	I, err := CompressedIndexContext(context.Background(), file, BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 8}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if I.SID_WIDTH != 4 {
+		t.Fatalf("sequence ids are %d bytes wide", I.SID_WIDTH)
+	}
+	if err := I.SaveCompressedIndexContext(context.Background(), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	J, err := LoadCompressedIndexContext(context.Background(), file+".fmi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if J.SID_WIDTH != 4 || !reflect.DeepEqual(J.SSA, I.SSA) {
+		t.Fatal("sequence ids differ after loading")
+	}
+	for _, k := range []int{0, 65535, 65536, 69999} {
+		if got := string(J.Extract(k, 0, J.LENS[k])); got != recs[k] || J.GENOME_ID[k] != "t"+strconv.Itoa(k) {
+			t.Errorf("sequence %d is %s %q instead of %q", k, J.GENOME_ID[k], got, recs[k])
+		}
+	}
+}
+
+func TestIndexWidth(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	recs := []string{randSeq(r, 300), randSeq(r, 500)}
+	file := writeFasta(t, recs)
+	opt := BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 3}
+	I := buildIndex(t, file, opt)
+	opt.IndexWidth = 8
+	J := buildIndex(t, file, opt)
+	if I.IDX_WIDTH != 4 || J.IDX_WIDTH != 8 || J.SA.Width != 8 || J.ISA.Width != 8 {
+		t.Fatalf("indices are %d and %d bytes wide", I.IDX_WIDTH, J.IDX_WIDTH)
+	}
+	if I.SA.String() != J.SA.String() || I.ISA.String() != J.ISA.String() {
+		t.Fatal("indices differ with their width")
+	}
+	if err := J.SaveCompressedIndexContext(context.Background(), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	L, err := LoadCompressedIndexContext(context.Background(), file+".fmi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if L.IDX_WIDTH != 8 {
+		t.Fatalf("loaded indices are %d bytes wide", L.IDX_WIDTH)
+	}
+	for k, rec := range recs {
+		if got := string(L.Extract(k, 0, L.LENS[k])); got != rec {
+			t.Errorf("sequence %d differs", k)
+		}
+	}
+	for _, q := range []string{recs[1][10:40], recs[0][:5], "ACGTACGTACGT"} {
+		a, b := I.Search([]byte(q))
+		c, d := L.Search([]byte(q))
+		if a != c || b != d {
+			t.Errorf("%s is in rows [%d,%d] with 4 bytes and [%d,%d] with 8", q, a, b, c, d)
+		}
+	}
+	if _, err := CompressedIndexContext(context.Background(), file, BuildOptions{Multiple: true, CompressionRatio: 4, IndexWidth: 2}, nil); err == nil {
+		t.Error("an index with 2-byte indices was built")
+	}
+}
@@ -0,0 +1,159 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Longest common prefixes of adjacent suffixes.
+*/
+package fmic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Rows per block of the range-minimum structure.
+const rmq_block = 64
+
+//-----------------------------------------------------------------------------
+// Compute LCP[i], the length of the longest common prefix of the suffixes at
+// rows i-1 and i (LCP[0] is 0), with the Φ algorithm of Kärkkäinen, Manzini
+// and Puglisi.  Common prefixes stop at the '|' between sequences, so they
+// never span two sequences.  It needs SEQ and the full suffix array.
+//-----------------------------------------------------------------------------
+func (I *IndexC) BuildLCP(ctx context.Context) error {
+	if len(I.SEQ) == 0 || I.SA_RATE > 0 || I.SA.Len() != I.LEN {
+		return errors.New("BuildLCP: the index needs SEQ and the full suffix array")
+	}
+	n := I.LEN
+	if n == 0 {
+		return nil
+	}
+
+	// PHI[p] is the suffix before suffix p in SA; it is then overwritten by
+	// PLCP[p], the LCP of suffix p in text order.
+	PHI := NewInts(I.IDX_WIDTH, n)
+	first := I.SA.Get(0)
+	for i := indexType(1); i < n; i++ {
+		PHI.Set(I.SA.Get(i), I.SA.Get(i-1))
+	}
+	var l indexType
+	for p := indexType(0); p < n; p++ {
+		if p%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p == first {
+			PHI.Set(p, 0)
+			l = 0
+			continue
+		}
+		q := PHI.Get(p)
+		for p+l < n && q+l < n && I.SEQ[p+l] == I.SEQ[q+l] && I.SEQ[p+l] != '|' {
+			l++
+		}
+		PHI.Set(p, l)
+		if l > 0 {
+			l--
+		}
+	}
+
+	I.LCP = NewInts(I.IDX_WIDTH, n)
+	for i := indexType(0); i < n; i++ {
+		if i%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		I.LCP.Set(i, PHI.Get(I.SA.Get(i)))
+	}
+	I.buildLCPRMQ()
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Build the range-minimum structure over LCP: the minimum of each block of
+// rmq_block rows, and a sparse table over these minima.
+//-----------------------------------------------------------------------------
+func (I *IndexC) buildLCPRMQ() {
+	n := I.LCP.Len()
+	num_blocks := (n + rmq_block - 1) / rmq_block
+	if num_blocks == 0 {
+		I.lcp_rmq = nil
+		return
+	}
+	level := make([]indexType, num_blocks)
+	for b := range level {
+		level[b] = I.LCP.Get(indexType(b) * rmq_block)
+		for i := indexType(b)*rmq_block + 1; i < n && i < indexType(b+1)*rmq_block; i++ {
+			if v := I.LCP.Get(i); v < level[b] {
+				level[b] = v
+			}
+		}
+	}
+	I.lcp_rmq = [][]indexType{level}
+	for w := 1; 2*w <= len(level); w *= 2 {
+		prev := I.lcp_rmq[len(I.lcp_rmq)-1]
+		next := make([]indexType, len(prev)-w)
+		for b := range next {
+			next[b] = prev[b]
+			if prev[b+w] < next[b] {
+				next[b] = prev[b+w]
+			}
+		}
+		I.lcp_rmq = append(I.lcp_rmq, next)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Minimum of LCP[i..j], i <= j.
+//-----------------------------------------------------------------------------
+func (I *IndexC) lcpMin(i, j indexType) indexType {
+	m := I.LCP.Get(i)
+	bi, bj := i/rmq_block, j/rmq_block
+	if bj-bi <= 1 {
+		for k := i + 1; k <= j; k++ {
+			if v := I.LCP.Get(k); v < m {
+				m = v
+			}
+		}
+		return m
+	}
+	for k := i + 1; k < (bi+1)*rmq_block; k++ {
+		if v := I.LCP.Get(k); v < m {
+			m = v
+		}
+	}
+	for k := bj * rmq_block; k <= j; k++ {
+		if v := I.LCP.Get(k); v < m {
+			m = v
+		}
+	}
+	// Whole blocks bi+1..bj-1, covered by two overlapping ranges of the table.
+	lo, hi := int(bi+1), int(bj-1)
+	lvl := 0
+	for 1<<uint(lvl+1) <= hi-lo+1 {
+		lvl++
+	}
+	if v := I.lcp_rmq[lvl][lo]; v < m {
+		m = v
+	}
+	if v := I.lcp_rmq[lvl][hi-(1<<uint(lvl))+1]; v < m {
+		m = v
+	}
+	return m
+}
+
+//-----------------------------------------------------------------------------
+// Length of the longest common prefix of the suffixes at rows i and j, which
+// must differ.  The index must have an LCP array (see BuildLCP).
+//-----------------------------------------------------------------------------
+func (I *IndexC) LongestCommonPrefix(i, j indexType) indexType {
+	if I.LCP.Len() == 0 {
+		panic("LongestCommonPrefix: index has no LCP array")
+	}
+	if i == j || i < 0 || j < 0 || i >= I.LEN || j >= I.LEN {
+		panic(fmt.Sprintf("LongestCommonPrefix: invalid rows %d and %d", i, j))
+	}
+	if i > j {
+		i, j = j, i
+	}
+	return I.lcpMin(i+1, j)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,55 @@
+package fmic
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// The longest common prefix of the suffixes at p and q of s, up to the first '|'.
+func naiveLCP(s []byte, p, q indexType) indexType {
+	l := indexType(0)
+	for int(p+l) < len(s) && int(q+l) < len(s) && s[p+l] == s[q+l] && s[p+l] != '|' {
+		l++
+	}
+	return l
+}
+
+func TestLCP(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	rep := randSeq(r, 150)
+	recs := []string{randSeq(r, 900), rep + rep, randSeq(r, 1), strings.Repeat("A", 300), rep, strings.Repeat("AC", 100), rep[:70]}
+	file := writeFasta(t, recs)
+	I := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 3, LCP: true})
+	if I.LCP.Get(0) != 0 {
+		t.Errorf("LCP[0] is %d", I.LCP.Get(0))
+	}
+	for i := indexType(1); i < I.LEN; i++ {
+		if want := naiveLCP(I.SEQ, I.SA.Get(i-1), I.SA.Get(i)); I.LCP.Get(i) != want {
+			t.Fatalf("LCP[%d] is %d instead of %d", i, I.LCP.Get(i), want)
+		}
+	}
+
+	if err := I.SaveCompressedIndexContext(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	J, err := LoadCompressedIndexContext(context.Background(), file+".fmi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := 0; k < 20000; k++ {
+		i, j := indexType(r.Intn(int(I.LEN))), indexType(r.Intn(int(I.LEN)))
+		if i == j {
+			continue
+		}
+		want := naiveLCP(I.SEQ, I.SA.Get(i), I.SA.Get(j))
+		if got, loaded := I.LongestCommonPrefix(i, j), J.LongestCommonPrefix(i, j); got != want || loaded != want {
+			t.Fatalf("rows %d and %d have a common prefix of %d, %d loaded, instead of %d", i, j, got, loaded, want)
+		}
+	}
+
+	if _, err := CompressedIndexContext(context.Background(), file, BuildOptions{CompressionRatio: 4, LCP: true, SARate: 4}, nil); err == nil {
+		t.Error("an LCP array was built with a sampled suffix array")
+	}
+}
@@ -8,10 +8,19 @@ const (
 
 // WorkSpace contains the O(1) scratch space used in constructing a suffix array with an alphabet of sisze 256 (any byte value).
 type WorkSpace struct {
-	bkt     [256]int // working space buckets
-	bktHead [256]int // save off bucket heads
-	bktTail [256]int // save off bucket tails
-	dirty   bool     // true if the scratch space is dirty from a previous run
+	bkt     [256]int       // working space buckets
+	bktHead [256]int       // save off bucket heads
+	bktTail [256]int       // save off bucket tails
+	dirty   bool           // true if the scratch space is dirty from a previous run
+	stage   func(string)   // if not nil, called at the start of each stage of the top level
+	emit    func(i, p int) // if not nil, called with each final SA[i] = p, from i = n-1 down to 0
+	workers int            // if > 1, goroutines inducing the suffixes of the top level (see parallel.go)
+}
+
+func (ws *WorkSpace) report(stage string) {
+	if ws.stage != nil {
+		ws.stage(stage)
+	}
 }
 
 // Compute the suffix array of S, storing it into SA. len(S) and len(SA) must be equal.
@@ -25,6 +34,7 @@ func (ws *WorkSpace) ComputeSuffixArray(S []byte, SA []int) {
 	// *********************************************
 	// Stage 1: Induced-sort the LMS-substrings of S
 	// *********************************************
+	ws.report("sort LMS substrings")
 
 	// step 1 - initialize SA as empty
 	setAllToEmpty(SA)
@@ -52,11 +62,11 @@ func (ws *WorkSpace) ComputeSuffixArray(S []byte, SA []int) {
 
 	// step 3 - induced sort the L-type suffixes of S into their buckets
 	copy(bkt, ws.bktHead[:])
-	induceSortL0(S, SA, bkt)
+	ws.induceSortL(S, SA)
 
 	// step 4 - induced sort the S-type suffixes of S into their buckets
 	copy(bkt, ws.bktTail[:])
-	induceSortS0(S, SA, bkt)
+	ws.induceSortS(S, SA, nil)
 
 	// NOT DESCRIBED IN PAPER BUT STILL NECESSARY (see SA-IS)
 	// We need to compact all the now-sorted LMS substrings into the first n1 positions of SA
@@ -79,6 +89,7 @@ func (ws *WorkSpace) ComputeSuffixArray(S []byte, SA []int) {
 	// *********************************************
 	// Stage 2: Rename the LMS substrings
 	// *********************************************
+	ws.report("rename LMS substrings")
 
 	// provably, n1 is at most floor(n/2), so the following overlapping works
 	SA1 := SA[:n1] // SA1 overlaps the front of SA
@@ -89,6 +100,7 @@ func (ws *WorkSpace) ComputeSuffixArray(S []byte, SA []int) {
 	// *********************************************
 	// Stage 3: Sort recursively
 	// *********************************************
+	ws.report("sort recursively")
 	sortRecursively(S1, SA1, k1)
 
 	// NOT DESCRIBED IN PAPER BUT STILL NECESSARY (see SA-IS)
@@ -119,6 +131,7 @@ func (ws *WorkSpace) ComputeSuffixArray(S []byte, SA []int) {
 	// *********************************************
 	// Stage 4: Induced-sort SA(S) from SA1(S1)
 	// *********************************************
+	ws.report("induce SA")
 
 	// step 1 - initialize SA[n1:] as empty
 	setAllToEmpty(SA[n1:])
@@ -139,11 +152,28 @@ func (ws *WorkSpace) ComputeSuffixArray(S []byte, SA []int) {
 
 	// step 3 - induced sort the L-type suffixes of S into their buckets
 	copy(bkt, ws.bktHead[:])
-	induceSortL0(S, SA, bkt)
+	ws.induceSortL(S, SA)
 
 	// step 4 - induced sort the S-type suffixes of S into their buckets
 	copy(bkt, ws.bktTail[:])
-	induceSortS0(S, SA, bkt)
+	ws.induceSortS(S, SA, ws.emit)
+}
+
+// The induce passes of the top level, in parallel if ws.workers > 1.
+func (ws *WorkSpace) induceSortL(S []byte, SA []int) {
+	if ws.workers > 1 {
+		induceSortL0Parallel(S, SA, ws.bkt[:], &ws.bktHead, &ws.bktTail, ws.workers)
+	} else {
+		induceSortL0(S, SA, ws.bkt[:])
+	}
+}
+
+func (ws *WorkSpace) induceSortS(S []byte, SA []int, emit func(i, p int)) {
+	if ws.workers > 1 {
+		induceSortS0Parallel(S, SA, ws.bkt[:], &ws.bktHead, &ws.bktTail, ws.workers, emit)
+	} else {
+		induceSortS0(S, SA, ws.bkt[:], emit)
+	}
 }
 
 func (ws *WorkSpace) computeBuckets(S []byte) {
@@ -208,12 +238,17 @@ func induceSortL0(S []byte, SA, bkt []int) {
 // pre-condition: SA contains properly bucketed L and LMS suffixes
 // pre-condition: bkt contains the tail of each character's bucket
 // post-condition: SA contains properly also contains all properly bucketed S-type suffixes
-func induceSortS0(S []byte, SA, bkt []int) {
+// if emit is not nil, it is called with each SA[i] when the scan reaches it; SA[i] is final by then,
+// because suffixes are only inserted in front of the scan
+func induceSortS0(S []byte, SA, bkt []int, emit func(i, p int)) {
 	n := len(S)
 
 	// at each step, look at the character *before* S[SA[i]]; if it's S-type, insert it
 	for i := n - 1; i >= 0; i-- {
 		SAi := SA[i]
+		if emit != nil {
+			emit(i, SAi)
+		}
 		if SAi <= 0 {
 			continue
 		}
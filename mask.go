@@ -0,0 +1,143 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Soft-masked regions of the sequences.
+*/
+package fmic
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A half-open interval [Start, End) of a sequence, in the orientation of the
+// input fasta file.
+type Interval struct {
+	Start, End indexType
+}
+
+// How seeds that fall entirely in soft-masked regions are used.
+type SeedMasking int
+
+const (
+	UseMaskedSeeds        SeedMasking = iota // like any other seed
+	DownWeightMaskedSeeds                    // only if no round of FindGenomeR finds an unmasked seed
+	IgnoreMaskedSeeds                        // as if they matched nothing
+)
+
+//-----------------------------------------------------------------------------
+// Record the lowercase runs of each sequence in MASKS, before the alphabet
+// folds them to uppercase.  The offsets must be computed.
+//-----------------------------------------------------------------------------
+func (I *IndexC) findMasks() {
+	n := indexType(len(I.SEQ))
+	I.MASKS = make([][]Interval, len(I.LENS))
+	for k := range I.LENS {
+		// Sequence k is SEQ[a:b] backwards.
+		b := n - 1 - I.offsets[k]
+		in_run := false
+		for x := indexType(0); x < I.LENS[k]; x++ {
+			c := I.SEQ[b-1-x]
+			lower := 'a' <= c && c <= 'z'
+			if lower && !in_run {
+				I.MASKS[k] = append(I.MASKS[k], Interval{Start: x})
+			}
+			if !lower && in_run {
+				I.MASKS[k][len(I.MASKS[k])-1].End = x
+			}
+			in_run = lower
+		}
+		if in_run {
+			I.MASKS[k][len(I.MASKS[k])-1].End = I.LENS[k]
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Whether positions [start, end) of sequence seqID are all soft-masked.
+//-----------------------------------------------------------------------------
+func (I *IndexC) Masked(seqID int, start, end indexType) bool {
+	if I.MASKS == nil || start >= end {
+		return false
+	}
+	masks := I.MASKS[seqID]
+	j := sort.Search(len(masks), func(j int) bool { return masks[j].End > start })
+	return j < len(masks) && masks[j].Start <= start && end <= masks[j].End
+}
+
+//-----------------------------------------------------------------------------
+// Whether the seed of the given length at position p of SEQ, which matches
+// the original text backwards from LEN-2-p, falls in a masked region.
+//-----------------------------------------------------------------------------
+func (I *IndexC) seedMasked(p indexType, length int) bool {
+	g := I.LEN - 2 - p
+	k := I.sequenceAt(g)
+	end := g + 1 - I.offsets[k]
+	return end >= indexType(length) && I.Masked(k, end-indexType(length), end)
+}
+
+//-----------------------------------------------------------------------------
+// Same as regionSearch, but seeds whose hits are all masked are handled by
+// masking.  The last result is whether they were kept, but are masked.
+//-----------------------------------------------------------------------------
+func (I *IndexC) maskedRegionSearch(query []byte, start_pos int, masking SeedMasking) (int, int, map[sequenceType]indexType, bool) {
+	id, pos, idSet, length := I.regionSearch(query, start_pos)
+	if masking == UseMaskedSeeds || I.MASKS == nil || len(idSet) == 0 {
+		return id, pos, idSet, false
+	}
+	masked := true
+	for sid, p := range idSet {
+		if !I.seedMasked(p, length) {
+			masked = false
+		} else if masking == IgnoreMaskedSeeds {
+			delete(idSet, sid)
+		}
+	}
+	if masking == IgnoreMaskedSeeds {
+		if _, ok := idSet[sequenceType(id)]; !ok {
+			id, pos = -1, -1
+		}
+		return id, pos, idSet, false
+	}
+	return id, pos, idSet, masked
+}
+
+//-----------------------------------------------------------------------------
+// The masks as lines "seqID start end", as saved in "masks".
+//-----------------------------------------------------------------------------
+func (I *IndexC) masksFile() []byte {
+	var buf bytes.Buffer
+	for k, masks := range I.MASKS {
+		for _, m := range masks {
+			fmt.Fprintf(&buf, "%d %d %d\n", k, m.Start, m.End)
+		}
+	}
+	return buf.Bytes()
+}
+
+func (I *IndexC) readMasks(s []byte) error {
+	I.MASKS = make([][]Interval, len(I.LENS))
+	scanner := bufio.NewScanner(bytes.NewReader(s))
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var k int
+		var m Interval
+		if _, err := fmt.Sscanf(scanner.Text(), "%d%d%d", &k, &m.Start, &m.End); err != nil {
+			return fmt.Errorf("masks:%d: %v", line, err)
+		}
+		if k < 0 || k >= len(I.LENS) || m.Start < 0 || m.Start >= m.End || m.End > I.LENS[k] {
+			return fmt.Errorf("masks:%d: invalid interval [%d,%d) of sequence %d", line, m.Start, m.End, k)
+		}
+		if n := len(I.MASKS[k]); n > 0 && m.Start < I.MASKS[k][n-1].End {
+			return fmt.Errorf("masks:%d: intervals of sequence %d are not sorted", line, k)
+		}
+		I.MASKS[k] = append(I.MASKS[k], m)
+	}
+	return scanner.Err()
+}
+
+//-----------------------------------------------------------------------------
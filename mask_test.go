@@ -0,0 +1,82 @@
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSoftMask(t *testing.T) {
+	fa := ">a\nacgtaACGTTGCAACGTGGATCCATcc\n>b\nGGGACTACGTTTAGCtttacgatcgatagcatGA\n>c\nttttacgatcgatagcatAACCGGTT\n"
+	b := NewIndexBuilder(BuildOptions{Multiple: true, CompressionRatio: 4, SoftMask: true})
+	b.AddReader("m", strings.NewReader(fa))
+	I, err := b.Build(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]Interval{{{0, 5}, {25, 27}}, {{15, 32}}, {{0, 18}}}
+	if !reflect.DeepEqual(I.MASKS, want) {
+		t.Fatalf("masks %v, want %v", I.MASKS, want)
+	}
+	if _, ok := I.C['a']; ok || !I.ALPHABET.FoldCase {
+		t.Fatal("lowercase was not folded")
+	}
+	if got := string(I.Extract(1, 13, 20)); got != "GCTTTAC" {
+		t.Fatalf("Extract: %s", got)
+	}
+	for _, c := range []struct {
+		k          int
+		start, end indexType
+		masked     bool
+	}{
+		{0, 0, 5, true}, {0, 1, 3, true}, {0, 4, 6, false}, {0, 25, 27, true}, {0, 5, 25, false},
+		{1, 16, 30, true}, {1, 14, 20, false}, {1, 31, 33, false}, {2, 0, 18, true}, {2, 3, 3, false},
+	} {
+		if I.Masked(c.k, c.start, c.end) != c.masked {
+			t.Errorf("Masked(%d, %d, %d) is not %v", c.k, c.start, c.end, c.masked)
+		}
+	}
+	// A seed that ends past the mask is not masked.
+	if id, _, _, masked := I.maskedRegionSearch(I.normalizeQuery([]byte("gatagcatGA")), 0, DownWeightMaskedSeeds); id != 1 || masked {
+		t.Fatalf("seed in %d, masked %v", id, masked)
+	}
+	if id, _, _, _ := I.maskedRegionSearch([]byte("ACGTGGATCCATCC"), 0, IgnoreMaskedSeeds); id != 0 {
+		t.Fatalf("seed in %d", id)
+	}
+
+	var buf bytes.Buffer
+	if _, err := I.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	J, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(J.MASKS, want) || !J.ALPHABET.FoldCase {
+		t.Fatalf("loaded masks %v", J.MASKS)
+	}
+	if s, _ := J.Stats("", 0); s.MaskedLength != 5+2+17+18 {
+		t.Fatalf("masked length %d", s.MaskedLength)
+	}
+}
+
+func TestReadMasksErrors(t *testing.T) {
+	I := &IndexC{LENS: []indexType{5, 8}}
+	if err := I.readMasks([]byte("0 0 2\n\n1 3 8\n0 3 5\n")); err != nil || !reflect.DeepEqual(I.MASKS, [][]Interval{{{0, 2}, {3, 5}}, {{3, 8}}}) {
+		t.Fatalf("%v %v", I.MASKS, err)
+	}
+	for s, suffix := range map[string]string{
+		"0 3 4\n0 1 2\n": "masks:2: intervals of sequence 0 are not sorted",
+		"0 3 4\n0 2 4\n": "masks:2: intervals of sequence 0 are not sorted",
+		"0 1 6\n":        "masks:1: invalid interval [1,6) of sequence 0",
+		"2 1 2\n":        "masks:1: invalid interval [1,2) of sequence 2",
+		"1 4 4\n":        "masks:1: invalid interval [4,4) of sequence 1",
+		"0 x 1\n":        "masks:1: expected integer",
+	} {
+		if err := I.readMasks([]byte(s)); err == nil || !strings.HasSuffix(err.Error(), suffix) {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+}
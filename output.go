@@ -0,0 +1,263 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Output of abundances in the formats of salmon and kallisto.
+*/
+package fmic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+// How a quantification was run, for the metadata files of salmon and
+// kallisto.
+//-----------------------------------------------------------------------------
+type RunInfo struct {
+	Command    []string // the command line
+	Index      string   // where the index was loaded from
+	Reads1     string
+	Reads2     string
+	Threads    int
+	Start      time.Time
+	Counts     *EqCounts
+	Replicates *Replicates // if any were drawn
+}
+
+//-----------------------------------------------------------------------------
+func (I *IndexC) checkAbundance(A *Abundance) error {
+	if len(A.NumReads) != I.NumTargets() {
+		return fmt.Errorf("abundances of %d sequences do not match the %d targets of the index", len(A.NumReads), I.NumTargets())
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Write A as the quant.sf file of salmon.  Names and lengths are those of
+// the index.
+//-----------------------------------------------------------------------------
+func (I *IndexC) WriteQuantSF(w io.Writer, A *Abundance) error {
+	if err := I.checkAbundance(A); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Name\tLength\tEffectiveLength\tTPM\tNumReads\n")
+	for k := range A.NumReads {
+		fmt.Fprintf(bw, "%s\t%d\t%.3f\t%.6f\t%.3f\n", I.GENOME_ID[k], I.LENS[k], A.EffLength[k], A.TPM[k], A.NumReads[k])
+	}
+	return bw.Flush()
+}
+
+//-----------------------------------------------------------------------------
+// Write A as the abundance.tsv file of kallisto.  Names and lengths are
+// those of the index.
+//-----------------------------------------------------------------------------
+func (I *IndexC) WriteAbundanceTSV(w io.Writer, A *Abundance) error {
+	if err := I.checkAbundance(A); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "target_id\tlength\teff_length\test_counts\ttpm\n")
+	for k := range A.NumReads {
+		fmt.Fprintf(bw, "%s\t%d\t%g\t%g\t%g\n", I.GENOME_ID[k], I.LENS[k], A.EffLength[k], A.NumReads[k], A.TPM[k])
+	}
+	return bw.Flush()
+}
+
+// The fields of salmon's cmd_info.json that tximeta reads.
+type salmonCmdInfo struct {
+	Command string `json:"command"`
+	Index   string `json:"index"`
+	LibType string `json:"libType"`
+	Mates1  string `json:"mates1"`
+	Mates2  string `json:"mates2"`
+	Threads string `json:"threads"`
+	Output  string `json:"output"`
+}
+
+// The fields of salmon's aux_info/meta_info.json that tximport reads.
+type salmonMetaInfo struct {
+	IndexFormatVersion int     `json:"index_format_version"`
+	NumTargets         int     `json:"num_targets"`
+	NumDecoyTargets    int     `json:"num_decoy_targets"`
+	NumBootstraps      int     `json:"num_bootstraps"`
+	SampType           string  `json:"samp_type,omitempty"`
+	NumProcessed       int     `json:"num_processed"`
+	NumMapped          int     `json:"num_mapped"`
+	NumDecoyFragments  int     `json:"num_decoy_fragments"`
+	PercentMapped      float64 `json:"percent_mapped"`
+	StartTime          string  `json:"start_time"`
+	EndTime            string  `json:"end_time"`
+}
+
+// The fields of kallisto's run_info.json.
+type kallistoRunInfo struct {
+	NumTargets       int     `json:"n_targets"`
+	NumBootstraps    int     `json:"n_bootstraps"`
+	NumProcessed     int     `json:"n_processed"`
+	NumPseudoaligned int     `json:"n_pseudoaligned"`
+	NumUnique        int     `json:"n_unique"`
+	PercentAligned   float64 `json:"p_pseudoaligned"`
+	PercentUnique    float64 `json:"p_unique"`
+	IndexVersion     int     `json:"index_version"`
+	StartTime        string  `json:"start_time"`
+	Call             string  `json:"call"`
+}
+
+//-----------------------------------------------------------------------------
+// Write, in dir, the files of a salmon quantification that tximport and
+// tximeta read: quant.sf, cmd_info.json and aux_info/meta_info.json, and the
+// replicates in aux_info/bootstrap.
+//-----------------------------------------------------------------------------
+func (I *IndexC) WriteSalmonOutput(dir string, A *Abundance, info RunInfo) error {
+	aux := path.Join(dir, "aux_info")
+	if err := os.MkdirAll(aux, 0777); err != nil {
+		return err
+	}
+	if err := writeFile(path.Join(dir, "quant.sf"), func(w io.Writer) error { return I.WriteQuantSF(w, A) }); err != nil {
+		return err
+	}
+	cmd := salmonCmdInfo{
+		Command: strings.Join(info.Command, " "),
+		Index:   info.Index,
+		LibType: "A",
+		Mates1:  info.Reads1,
+		Mates2:  info.Reads2,
+		Threads: fmt.Sprint(info.Threads),
+		Output:  dir,
+	}
+	if err := writeJSON(path.Join(dir, "cmd_info.json"), cmd); err != nil {
+		return err
+	}
+
+	meta := salmonMetaInfo{
+		IndexFormatVersion: I.FormatVersion(),
+		NumTargets:         I.NumTargets(),
+		NumDecoyTargets:    I.NUM_DECOYS,
+		StartTime:          info.Start.Format(time.ANSIC),
+		EndTime:            time.Now().Format(time.ANSIC),
+	}
+	if E := info.Counts; E != nil {
+		meta.NumProcessed = E.Assigned + E.Unassigned + E.Decoy
+		meta.NumMapped = E.Assigned
+		meta.NumDecoyFragments = E.Decoy
+		meta.PercentMapped = percent(E.Assigned, meta.NumProcessed)
+	}
+	if R := info.Replicates; R != nil {
+		meta.NumBootstraps = len(R.NumReads)
+		meta.SampType = "bootstrap"
+		if R.Method == Gibbs {
+			meta.SampType = "gibbs"
+		}
+		if err := writeSalmonReplicates(path.Join(aux, "bootstrap"), R); err != nil {
+			return err
+		}
+	}
+	return writeJSON(path.Join(aux, "meta_info.json"), meta)
+}
+
+//-----------------------------------------------------------------------------
+// Replicates as salmon writes them: the names on one line separated by tabs
+// in names.tsv.gz, and the number of read pairs of each replicate as
+// little-endian float64 in bootstraps.gz.
+//-----------------------------------------------------------------------------
+func writeSalmonReplicates(dir string, R *Replicates) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	err := writeFile(path.Join(dir, "names.tsv.gz"), func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		if _, err := io.WriteString(gz, strings.Join(R.IDs, "\t")+"\n"); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+	if err != nil {
+		return err
+	}
+	return writeFile(path.Join(dir, "bootstraps.gz"), func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		for _, num_reads := range R.NumReads {
+			if err := binary.Write(gz, binary.LittleEndian, num_reads); err != nil {
+				return err
+			}
+		}
+		return gz.Close()
+	})
+}
+
+//-----------------------------------------------------------------------------
+// Write, in dir, the plain text files of a kallisto quantification:
+// abundance.tsv and run_info.json.  The HDF5 file is not written.
+//-----------------------------------------------------------------------------
+func (I *IndexC) WriteKallistoOutput(dir string, A *Abundance, info RunInfo) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	if err := writeFile(path.Join(dir, "abundance.tsv"), func(w io.Writer) error { return I.WriteAbundanceTSV(w, A) }); err != nil {
+		return err
+	}
+	run := kallistoRunInfo{
+		NumTargets:   I.NumTargets(),
+		IndexVersion: I.FormatVersion(),
+		StartTime:    info.Start.Format(time.ANSIC),
+		Call:         strings.Join(info.Command, " "),
+	}
+	if E := info.Counts; E != nil {
+		run.NumProcessed = E.Assigned + E.Unassigned + E.Decoy
+		run.NumPseudoaligned = E.Assigned
+		for _, class := range E.Classes {
+			if len(class.IDs) == 1 {
+				run.NumUnique += class.Count
+			}
+		}
+		run.PercentAligned = percent(run.NumPseudoaligned, run.NumProcessed)
+		run.PercentUnique = percent(run.NumUnique, run.NumProcessed)
+	}
+	if info.Replicates != nil {
+		run.NumBootstraps = len(info.Replicates.NumReads)
+	}
+	return writeJSON(path.Join(dir, "run_info.json"), run)
+}
+
+//-----------------------------------------------------------------------------
+func percent(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return math.Round(1e4*float64(a)/float64(b)) / 100
+}
+
+//-----------------------------------------------------------------------------
+// Create file and write it with write.
+//-----------------------------------------------------------------------------
+func writeFile(file string, write func(w io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSON(file string, v interface{}) error {
+	return writeFile(file, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(v)
+	})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,121 @@
+package fmic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readGzip(t *testing.T, file string) []byte {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readJSON(t *testing.T, file string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteSalmonOutput(t *testing.T) {
+	I, A, E := replicatesInput(t)
+	E.Unassigned, E.Decoy = 30, 20
+	J := buildIndex(t, writeFasta(t, []string{"ACGTACGT"}), BuildOptions{Multiple: true, CompressionRatio: 4})
+	if err := J.WriteSalmonOutput(t.TempDir(), A, RunInfo{}); err == nil {
+		t.Fatal("abundances of 3 targets were written for an index of 1")
+	}
+	R, err := A.Replicates(context.Background(), E, ReplicateOptions{Method: Gibbs, N: 5, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := path.Join(t.TempDir(), "out")
+	info := RunInfo{Command: []string{"rnaq", "quant"}, Index: "x.fmi", Reads1: "r1.fq", Reads2: "r2.fq", Threads: 4, Start: time.Now(), Counts: E, Replicates: R}
+	if err := I.WriteSalmonOutput(dir, A, info); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := I.WriteQuantSF(&buf, A); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path.Join(dir, "quant.sf")); !bytes.Equal(data, buf.Bytes()) {
+		t.Fatalf("quant.sf:\n%s", data)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 5 || lines[0] != "Name\tLength\tEffectiveLength\tTPM\tNumReads" || !strings.HasPrefix(lines[2], "t1\t1500\t1301.000\t") {
+		t.Fatalf("quant.sf:\n%s", buf.String())
+	}
+	var cmd salmonCmdInfo
+	readJSON(t, path.Join(dir, "cmd_info.json"), &cmd)
+	if want := (salmonCmdInfo{"rnaq quant", "x.fmi", "A", "r1.fq", "r2.fq", "4", dir}); cmd != want {
+		t.Fatalf("cmd_info %+v", cmd)
+	}
+	var meta salmonMetaInfo
+	readJSON(t, path.Join(dir, "aux_info", "meta_info.json"), &meta)
+	if meta.NumTargets != 3 || meta.NumBootstraps != 5 || meta.SampType != "gibbs" || meta.NumProcessed != 700 || meta.NumMapped != 650 || meta.NumDecoyFragments != 20 || meta.PercentMapped != 92.86 {
+		t.Fatalf("meta_info %+v", meta)
+	}
+
+	// Replicates, as float64 rows in the order of the names.
+	boot := path.Join(dir, "aux_info", "bootstrap")
+	if names := string(readGzip(t, path.Join(boot, "names.tsv.gz"))); names != "t0\tt1\tt2\n" {
+		t.Fatalf("names %q", names)
+	}
+	data := readGzip(t, path.Join(boot, "bootstraps.gz"))
+	rows := make([]float64, len(data)/8)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, rows)
+	if len(data) != 8*5*3 || !reflect.DeepEqual(rows[3:6], R.NumReads[1]) {
+		t.Fatalf("%d bytes of bootstraps", len(data))
+	}
+}
+
+func TestWriteKallistoOutput(t *testing.T) {
+	I, A, E := replicatesInput(t)
+	E.Unassigned, E.Decoy = 30, 20
+	dir := path.Join(t.TempDir(), "out")
+	if err := I.WriteKallistoOutput(dir, A, RunInfo{Command: []string{"rnaq", "quant"}, Counts: E}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := I.WriteAbundanceTSV(&buf, A); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path.Join(dir, "abundance.tsv")); !bytes.Equal(data, buf.Bytes()) {
+		t.Fatalf("abundance.tsv:\n%s", data)
+	}
+	if lines := strings.Split(buf.String(), "\n"); len(lines) != 5 || lines[0] != "target_id\tlength\teff_length\test_counts\ttpm" || !strings.HasPrefix(lines[3], "t2\t800\t601\t100") {
+		t.Fatalf("abundance.tsv:\n%s", buf.String())
+	}
+	var run kallistoRunInfo
+	readJSON(t, path.Join(dir, "run_info.json"), &run)
+	if run.NumTargets != 3 || run.NumBootstraps != 0 || run.NumProcessed != 700 || run.NumPseudoaligned != 650 || run.NumUnique != 600 || run.PercentAligned != 92.86 || run.PercentUnique != 85.71 || run.Call != "rnaq quant" {
+		t.Fatalf("run_info %+v", run)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Parallel induced sorting.
+*/
+package fmic
+
+import (
+	"sync"
+)
+
+// Final entries of a bucket are induced sequentially if there are fewer.
+const min_parallel_block = 1 << 14
+
+//-----------------------------------------------------------------------------
+// Same as induceSortL0, with workers goroutines.  The buckets are scanned in
+// order, and each run of final entries in a bucket is induced at once: the
+// workers count the suffixes that each part of the run puts in every bucket,
+// then put them, each part after the parts before it, so SA ends up as the
+// sequential scan leaves it.  Suffixes with the same first character as the
+// scanned bucket go after the run, so the run is never written while it is
+// read.
+//-----------------------------------------------------------------------------
+func induceSortL0Parallel(S []byte, SA, bkt []int, heads, tails *[256]int, workers int) {
+	n := len(S)
+	c := S[n-1]
+	SA[bkt[c]] = n - 1
+	bkt[c]++
+
+	counts := make([][256]int, workers)
+	for c := 0; c < 256; c++ {
+		for i := heads[c]; i <= tails[c]; {
+			// The L-type suffixes of c grow at the front of the bucket; once
+			// the scan catches up with them, the rest of the bucket holds LMS
+			// suffixes, which do not induce suffixes of c.
+			end := bkt[c]
+			if i >= end {
+				end = tails[c] + 1
+			}
+			induceBlockL0(S, SA, bkt, i, end, counts)
+			i = end
+		}
+	}
+}
+
+// Induce the L-type suffixes before the final SA[lo:hi].
+func induceBlockL0(S []byte, SA, bkt []int, lo, hi int, counts [][256]int) {
+	if hi-lo < min_parallel_block || len(counts) < 2 {
+		for _, SAi := range SA[lo:hi] {
+			if SAi > 0 && S[SAi-1] >= S[SAi] {
+				c := S[SAi-1]
+				SA[bkt[c]] = SAi - 1
+				bkt[c]++
+			}
+		}
+		return
+	}
+	parts := splitBlock(lo, hi, len(counts))
+	forEachPart(parts, func(w, lo, hi int) {
+		counts[w] = [256]int{}
+		for _, SAi := range SA[lo:hi] {
+			if SAi > 0 && S[SAi-1] >= S[SAi] {
+				counts[w][S[SAi-1]]++
+			}
+		}
+	})
+	for c := 0; c < 256; c++ {
+		next := bkt[c]
+		for w := range parts {
+			next, counts[w][c] = next+counts[w][c], next
+		}
+		bkt[c] = next
+	}
+	forEachPart(parts, func(w, lo, hi int) {
+		next := &counts[w]
+		for _, SAi := range SA[lo:hi] {
+			if SAi > 0 && S[SAi-1] >= S[SAi] {
+				c := S[SAi-1]
+				SA[next[c]] = SAi - 1
+				next[c]++
+			}
+		}
+	})
+}
+
+//-----------------------------------------------------------------------------
+// Same as induceSortS0, with workers goroutines (see induceSortL0Parallel).
+// The buckets are scanned from the last.  In each bucket, the S-type
+// suffixes grow from its tail and are scanned first; then the rest of the
+// bucket holds its L-type suffixes, which only induce suffixes of smaller
+// buckets.  emit is called from this goroutine, in the same order as
+// induceSortS0 calls it.
+//-----------------------------------------------------------------------------
+func induceSortS0Parallel(S []byte, SA, bkt []int, heads, tails *[256]int, workers int, emit func(i, p int)) {
+	counts := make([][256]int, workers)
+	for c := 255; c >= 0; c-- {
+		for i := tails[c]; i >= heads[c]; {
+			lo, s_type := bkt[c]+1, true
+			if i < lo {
+				lo, s_type = heads[c], false
+			}
+			induceBlockS0(S, SA, bkt, lo, i+1, s_type, counts)
+			if emit != nil {
+				for k := i; k >= lo; k-- {
+					emit(k, SA[k])
+				}
+			}
+			i = lo - 1
+		}
+	}
+}
+
+// Induce the S-type suffixes before the final SA[lo:hi], which are all
+// S-type if s_type, and all L-type otherwise.
+func induceBlockS0(S []byte, SA, bkt []int, lo, hi int, s_type bool, counts [][256]int) {
+	induces := func(SAi int) bool {
+		return SAi > 0 && (S[SAi-1] < S[SAi] || s_type && S[SAi-1] == S[SAi])
+	}
+	if hi-lo < min_parallel_block || len(counts) < 2 {
+		for k := hi - 1; k >= lo; k-- {
+			if SAi := SA[k]; induces(SAi) {
+				c := S[SAi-1]
+				SA[bkt[c]] = SAi - 1
+				bkt[c]--
+			}
+		}
+		return
+	}
+	// Part w is scanned before part w-1, so its suffixes go in front of them.
+	parts := splitBlock(lo, hi, len(counts))
+	forEachPart(parts, func(w, lo, hi int) {
+		counts[w] = [256]int{}
+		for _, SAi := range SA[lo:hi] {
+			if induces(SAi) {
+				counts[w][S[SAi-1]]++
+			}
+		}
+	})
+	for c := 0; c < 256; c++ {
+		next := bkt[c]
+		for w := len(parts) - 1; w >= 0; w-- {
+			next, counts[w][c] = next-counts[w][c], next
+		}
+		bkt[c] = next
+	}
+	forEachPart(parts, func(w, lo, hi int) {
+		next := &counts[w]
+		for k := hi - 1; k >= lo; k-- {
+			if SAi := SA[k]; induces(SAi) {
+				c := S[SAi-1]
+				SA[next[c]] = SAi - 1
+				next[c]--
+			}
+		}
+	})
+}
+
+//-----------------------------------------------------------------------------
+// Split [lo, hi) into at most workers consecutive parts.
+//-----------------------------------------------------------------------------
+func splitBlock(lo, hi, workers int) [][2]int {
+	size := (hi - lo + workers - 1) / workers
+	var parts [][2]int
+	for ; lo < hi; lo += size {
+		end := lo + size
+		if end > hi {
+			end = hi
+		}
+		parts = append(parts, [2]int{lo, end})
+	}
+	return parts
+}
+
+// Call f on every part at once, and wait for them.
+func forEachPart(parts [][2]int, f func(w, lo, hi int)) {
+	var wg sync.WaitGroup
+	for w, part := range parts {
+		wg.Add(1)
+		go func(w, lo, hi int) {
+			defer wg.Done()
+			f(w, lo, hi)
+		}(w, part[0], part[1])
+	}
+	wg.Wait()
+}
+
+//-----------------------------------------------------------------------------
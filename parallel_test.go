@@ -0,0 +1,58 @@
+package fmic
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// A repeated unit around a long run of N, as in a scaffold with a gap.
+func repetitiveText(r *rand.Rand) []byte {
+	unit := randSeq(r, 20000)
+	return []byte(unit + strings.Repeat("N", 400000) + unit + "$")
+}
+
+func TestInduceSortParallel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	texts := [][]byte{
+		repetitiveText(r),
+		[]byte(randSeq(r, 300000) + "$"),
+		[]byte(strings.Repeat("ACGTTGCA", 40000) + "$"),
+	}
+	for k, S := range texts {
+		want := make([]int, len(S))
+		new(WorkSpace).ComputeSuffixArray(S, want)
+		for _, workers := range []int{2, 3, 8} {
+			SA := make([]int, len(S))
+			next := len(S) - 1
+			ws := &WorkSpace{workers: workers, emit: func(i, p int) {
+				if i != next {
+					t.Fatalf("text %d, %d workers: row %d emitted instead of %d", k, workers, i, next)
+				}
+				next--
+			}}
+			ws.ComputeSuffixArray(S, SA)
+			for i := range SA {
+				if SA[i] != want[i] {
+					t.Fatalf("text %d, %d workers: SA[%d] = %d instead of %d", k, workers, i, SA[i], want[i])
+				}
+			}
+			if next != -1 {
+				t.Fatalf("text %d, %d workers: %d rows not emitted", k, workers, next+1)
+			}
+		}
+	}
+}
+
+func TestBuildWithWorkers(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	unit := randSeq(r, 3000)
+	recs := []string{unit, strings.Repeat("N", 40000), unit, randSeq(r, 20000), strings.Repeat("AC", 10000), randSeq(r, 1)}
+	file := writeFasta(t, recs)
+	opt := BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 3, Workers: 1}
+	I := buildIndex(t, file, opt)
+	for _, workers := range []int{0, 2, 8} {
+		opt.Workers = workers
+		sameIndex(t, I, buildIndex(t, file, opt))
+	}
+}
@@ -0,0 +1,96 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Cancellation and progress reporting of long builds and runs.
+*/
+package fmic
+
+import (
+	"context"
+	"io"
+)
+
+// Phases reported to Progress.Phase.  The suffix array construction also
+// reports its own stages, prefixed by PhaseSuffixArray.
+const (
+	PhaseReadFasta   = "read fasta"
+	PhaseSuffixArray = "suffix array"
+	PhaseBWT         = "bwt"
+	PhaseOCC         = "occ"
+	PhaseLCP         = "lcp"
+	PhaseSave        = "save"
+	PhaseLoad        = "load"
+	PhaseQuant       = "quant"
+)
+
+// How many loop iterations pass between two checks of the context.
+const check_interval = 1 << 20
+
+//-----------------------------------------------------------------------------
+// Progress receives reports from the Context variants of index build, save,
+// load and quant.  A nil Progress reports nothing.
+//-----------------------------------------------------------------------------
+type Progress interface {
+	Phase(phase string)                       // a new phase has started
+	BytesRead(n int64)                        // bytes of fasta read so far
+	ReadsProcessed(n int, per_second float64) // read pairs processed so far
+}
+
+type noProgress struct{}
+
+func (noProgress) Phase(string)                {}
+func (noProgress) BytesRead(int64)             {}
+func (noProgress) ReadsProcessed(int, float64) {}
+
+func orNoProgress(progress Progress) Progress {
+	if progress == nil {
+		return noProgress{}
+	}
+	return progress
+}
+
+//-----------------------------------------------------------------------------
+// cancelled is panicked to unwind the suffix array construction when the
+// context is done, and recovered by CompressedIndexContext.
+//-----------------------------------------------------------------------------
+type cancelled struct {
+	err error
+}
+
+//-----------------------------------------------------------------------------
+// ctxReader fails once ctx is done, and reports the number of bytes read.
+//-----------------------------------------------------------------------------
+type ctxReader struct {
+	ctx       context.Context
+	r         io.Reader
+	n         int64
+	bytesRead func(int64)
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.bytesRead != nil {
+		r.bytesRead(r.n)
+	}
+	return n, err
+}
+
+//-----------------------------------------------------------------------------
+// ctxWriter fails once ctx is done.
+//-----------------------------------------------------------------------------
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,84 @@
+package fmic
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recordProgress records the phases, and cancels its context when a phase
+// starting with cancel_at starts.
+type recordProgress struct {
+	phases    []string
+	bytes     int64
+	reads     int
+	cancel_at string
+	cancel    context.CancelFunc
+}
+
+func (p *recordProgress) Phase(phase string) {
+	p.phases = append(p.phases, phase)
+	if p.cancel != nil && strings.HasPrefix(phase, p.cancel_at) {
+		p.cancel()
+	}
+}
+
+func (p *recordProgress) BytesRead(n int64)                        { p.bytes = n }
+func (p *recordProgress) ReadsProcessed(n int, per_second float64) { p.reads = n }
+
+func TestProgress(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	recs, frags, _ := simulatedLibrary(r)
+	file := writeFasta(t, recs)
+	p := &recordProgress{}
+	I, err := CompressedIndexContext(context.Background(), file, BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 4}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(file)
+	if p.bytes != info.Size() {
+		t.Errorf("%d bytes of %d read", p.bytes, info.Size())
+	}
+	phases := strings.Join(p.phases, ", ")
+	for _, phase := range []string{PhaseReadFasta, PhaseSuffixArray + ": ", PhaseOCC} {
+		if !strings.Contains(phases, phase) {
+			t.Errorf("phase %q is not in %s", phase, phases)
+		}
+	}
+
+	p = &recordProgress{}
+	r1, r2 := writePairs(recs, frags, 50)
+	if _, err := I.QuantReaderContext(context.Background(), r1, r2, QuantOptions{Workers: 2, BatchSize: 50}, p); err != nil {
+		t.Fatal(err)
+	}
+	if p.reads != len(frags) || len(p.phases) != 1 || p.phases[0] != PhaseQuant {
+		t.Errorf("%d of %d pairs processed in phases %v", p.reads, len(frags), p.phases)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	file := writeFasta(t, []string{randSeq(r, 5000), randSeq(r, 7000)})
+	for _, phase := range []string{PhaseReadFasta, PhaseSuffixArray, PhaseOCC} {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := &recordProgress{cancel_at: phase, cancel: cancel}
+		if _, err := CompressedIndexContext(ctx, file, BuildOptions{Multiple: true, CompressionRatio: 4, ISARate: 4}, p); err != context.Canceled {
+			t.Errorf("canceled at %s: %v", phase, err)
+		}
+	}
+
+	I := CompressedIndexSampled(file, true, 4, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := I.SaveCompressedIndexContext(ctx, 1, nil); err != context.Canceled {
+		t.Errorf("canceled save: %v", err)
+	}
+	if err := I.SaveCompressedIndexContext(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCompressedIndexContext(ctx, file+".fmi", nil); err != context.Canceled {
+		t.Errorf("canceled load: %v", err)
+	}
+}
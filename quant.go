@@ -0,0 +1,325 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Multi-threaded quantification of paired-end reads.
+*/
+package fmic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ReadPair struct {
+	Read1 []byte
+	Read2 []byte
+}
+
+type QuantOptions struct {
+	Workers   int   // number of worker goroutines (default: number of CPUs)
+	BatchSize int   // number of read pairs per batch (default: 4096)
+	QueueSize int   // number of batches buffered between stages (default: 2*Workers)
+	MaxInsert int   // maximum insert size of a pair
+	Rounds    int   // rounds of FindGenomeR; FindGenomeD is used if Rounds is 0
+	Seed      int64 // seed of the randomized rounds
+
+	MaskedSeeds SeedMasking // how seeds in soft-masked regions are used
+	Bias        bool        // count the fragments of uniquely assigned pairs in EqCounts.Bias
+}
+
+// An equivalence class is the set of sequences a read pair is assigned to.
+type EqClass struct {
+	IDs   []int // sorted sequence ids
+	Count int
+}
+
+type EqCounts struct {
+	Classes    map[string]*EqClass // keyed by the comma-separated IDs
+	Assigned   int
+	Unassigned int
+	Decoy      int         // read pairs that only hit decoys
+	Bias       *BiasCounts // if QuantOptions.Bias
+}
+
+type readBatch struct {
+	id    int64
+	pairs []ReadPair
+}
+
+//-----------------------------------------------------------------------------
+func (opt QuantOptions) withDefaults() QuantOptions {
+	if opt.Workers <= 0 {
+		opt.Workers = runtime.NumCPU()
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 4096
+	}
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = 2 * opt.Workers
+	}
+	return opt
+}
+
+//-----------------------------------------------------------------------------
+func NewEqCounts() *EqCounts {
+	return &EqCounts{Classes: make(map[string]*EqClass)}
+}
+
+//-----------------------------------------------------------------------------
+// Add count read pairs to the equivalence class of ids (ids is sorted).
+//-----------------------------------------------------------------------------
+func (E *EqCounts) Add(ids []int, count int) {
+	if len(ids) == 0 {
+		E.Unassigned += count
+		return
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = strconv.Itoa(id)
+	}
+	key := strings.Join(keys, ",")
+	if class, ok := E.Classes[key]; ok {
+		class.Count += count
+	} else {
+		E.Classes[key] = &EqClass{IDs: ids, Count: count}
+	}
+	E.Assigned += count
+}
+
+//-----------------------------------------------------------------------------
+func (E *EqCounts) Merge(other *EqCounts) {
+	for key, class := range other.Classes {
+		if c, ok := E.Classes[key]; ok {
+			c.Count += class.Count
+		} else {
+			E.Classes[key] = class
+		}
+	}
+	E.Assigned += other.Assigned
+	E.Unassigned += other.Unassigned
+	E.Decoy += other.Decoy
+	if other.Bias != nil {
+		if E.Bias == nil {
+			E.Bias = new(BiasCounts)
+		}
+		E.Bias.merge(other.Bias)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// The classes in the order of their keys.
+//-----------------------------------------------------------------------------
+func (E *EqCounts) sortedClasses() []*EqClass {
+	keys := make([]string, 0, len(E.Classes))
+	for key := range E.Classes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	classes := make([]*EqClass, len(keys))
+	for i, key := range keys {
+		classes[i] = E.Classes[key]
+	}
+	return classes
+}
+
+//-----------------------------------------------------------------------------
+// Quantify the paired-end reads stored in two fastq files.
+//-----------------------------------------------------------------------------
+func (I *IndexC) Quant(read1_file, read2_file string, opt QuantOptions) *EqCounts {
+	counts, err := I.QuantContext(context.Background(), read1_file, read2_file, opt, nil)
+	check_for_error(err)
+	return counts
+}
+
+//-----------------------------------------------------------------------------
+func (I *IndexC) QuantContext(ctx context.Context, read1_file, read2_file string, opt QuantOptions, progress Progress) (*EqCounts, error) {
+	f1, err := os.Open(read1_file)
+	if err != nil {
+		return nil, err
+	}
+	defer f1.Close()
+	f2, err := os.Open(read2_file)
+	if err != nil {
+		return nil, err
+	}
+	defer f2.Close()
+	return I.QuantReaderContext(ctx, f1, f2, opt, progress)
+}
+
+//-----------------------------------------------------------------------------
+func (I *IndexC) QuantReader(r1, r2 io.Reader, opt QuantOptions) *EqCounts {
+	counts, err := I.QuantReaderContext(context.Background(), r1, r2, opt, nil)
+	check_for_error(err)
+	return counts
+}
+
+//-----------------------------------------------------------------------------
+// One goroutine reads batches of pairs, opt.Workers goroutines assign them
+// to sequences, and the calling goroutine aggregates the equivalence class
+// counts.  The channels between the stages are bounded by opt.QueueSize, so
+// the reader blocks when the workers fall behind.  When ctx is done, the
+// reader stops, the workers skip the queued batches, and ctx.Err() is returned.
+//-----------------------------------------------------------------------------
+func (I *IndexC) QuantReaderContext(ctx context.Context, r1, r2 io.Reader, opt QuantOptions, progress Progress) (*EqCounts, error) {
+	progress = orNoProgress(progress)
+	progress.Phase(PhaseQuant)
+	opt = opt.withDefaults()
+	batches := make(chan readBatch, opt.QueueSize)
+	results := make(chan *EqCounts, opt.QueueSize)
+
+	var read_err error
+	go func() {
+		defer close(batches)
+		read_err = readPairs(ctx, r1, r2, opt.BatchSize, batches)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(opt.Workers)
+	for w := 0; w < opt.Workers; w++ {
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if ctx.Err() == nil {
+					results <- I.assignBatch(batch, opt)
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	counts := NewEqCounts()
+	if opt.Bias {
+		counts.Bias = new(BiasCounts) // even if there are no reads
+	}
+	start, last := time.Now(), time.Now()
+	for r := range results {
+		counts.Merge(r)
+		if time.Since(last) >= time.Second {
+			last = time.Now()
+			n := counts.Assigned + counts.Unassigned + counts.Decoy
+			progress.ReadsProcessed(n, float64(n)/last.Sub(start).Seconds())
+		}
+	}
+	if read_err != nil {
+		return nil, read_err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	n := counts.Assigned + counts.Unassigned + counts.Decoy
+	progress.ReadsProcessed(n, float64(n)/time.Since(start).Seconds())
+	return counts, nil
+}
+
+//-----------------------------------------------------------------------------
+// Each batch has its own random source, seeded by its position in the input,
+// so that results do not depend on the number of workers.
+//-----------------------------------------------------------------------------
+func (I *IndexC) assignBatch(batch readBatch, opt QuantOptions) *EqCounts {
+	counts := NewEqCounts()
+	if opt.Bias {
+		counts.Bias = new(BiasCounts)
+	}
+	rng := rand.New(rand.NewSource(opt.Seed + batch.id))
+	var out map[int]int
+	for _, p := range batch.pairs {
+		if opt.Rounds > 0 {
+			out = I.findGenomeR(p.Read1, p.Read2, opt.MaxInsert, opt.Rounds, rng.Intn, opt.MaskedSeeds)
+		} else {
+			out = I.findGenomeD(p.Read1, p.Read2, opt.MaxInsert, opt.MaskedSeeds)
+		}
+		ids := make([]int, 0, len(out))
+		for id := range out {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		if len(ids) > 0 && I.IsDecoy(ids[0]) {
+			counts.Decoy++
+			continue
+		}
+		counts.Add(ids, 1)
+		if counts.Bias != nil && len(ids) == 1 {
+			if start, end, ok := I.fragmentOf(ids[0], p); ok {
+				counts.Bias.add(I, ids[0], start, end)
+			}
+		}
+	}
+	return counts
+}
+
+//-----------------------------------------------------------------------------
+// Read the two fastq streams in lockstep and send batches of pairs.
+//-----------------------------------------------------------------------------
+func readPairs(ctx context.Context, r1, r2 io.Reader, batch_size int, batches chan<- readBatch) error {
+	s1, s2 := newFastqScanner(r1), newFastqScanner(r2)
+	batch := readBatch{pairs: make([]ReadPair, 0, batch_size)}
+	for {
+		read1, ok1 := nextFastq(s1)
+		read2, ok2 := nextFastq(s2)
+		if ok1 != ok2 {
+			return errors.New("readPairs: read files have different numbers of reads")
+		}
+		if !ok1 {
+			break
+		}
+		batch.pairs = append(batch.pairs, ReadPair{read1, read2})
+		if len(batch.pairs) == batch_size {
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			batch = readBatch{id: batch.id + 1, pairs: make([]ReadPair, 0, batch_size)}
+		}
+	}
+	if s1.Err() != nil {
+		return s1.Err()
+	}
+	if s2.Err() != nil {
+		return s2.Err()
+	}
+	if len(batch.pairs) > 0 {
+		batches <- batch
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+func newFastqScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	return scanner
+}
+
+//-----------------------------------------------------------------------------
+// Returns the sequence of the next fastq record.
+//-----------------------------------------------------------------------------
+func nextFastq(scanner *bufio.Scanner) ([]byte, bool) {
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 && scanner.Bytes()[0] == '@' {
+			break
+		}
+	}
+	if !scanner.Scan() {
+		return nil, false
+	}
+	seq := append([]byte(nil), bytes.TrimRight(scanner.Bytes(), "\r ")...)
+	scanner.Scan() // +
+	scanner.Scan() // quality
+	return seq, true
+}
+
+//-----------------------------------------------------------------------------
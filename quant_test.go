@@ -0,0 +1,133 @@
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type fragment struct{ k, start, end int }
+
+// The two reads of each fragment, of length read_len at its ends, as fastq.
+func writePairs(recs []string, frags []fragment, read_len int) (*bytes.Buffer, *bytes.Buffer) {
+	var r1, r2 bytes.Buffer
+	for _, f := range frags {
+		n := read_len
+		if n > f.end-f.start {
+			n = f.end - f.start
+		}
+		rec, qual := recs[f.k], strings.Repeat("I", n)
+		r1.WriteString("@r\n" + rec[f.start:f.start+n] + "\n+\n" + qual + "\n")
+		r2.WriteString("@r\n" + rec[f.end-n:f.end] + "\n+\n" + qual + "\n")
+	}
+	return &r1, &r2
+}
+
+// Fragments of three sequences, and the number of pairs of each.
+func simulatedLibrary(r *rand.Rand) ([]string, []fragment, []int) {
+	recs := []string{randSeq(r, 600), randSeq(r, 700), randSeq(r, 400)}
+	counts := []int{200, 300, 100}
+	var frags []fragment
+	for k, n := range counts {
+		for i := 0; i < n; i++ {
+			start := r.Intn(len(recs[k]) - 150)
+			frags = append(frags, fragment{k, start, start + 150})
+		}
+	}
+	r.Shuffle(len(frags), func(i, j int) { frags[i], frags[j] = frags[j], frags[i] })
+	return recs, frags, counts
+}
+
+func TestQuantWorkers(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	recs, frags, want := simulatedLibrary(r)
+	I := CompressedIndex(writeFasta(t, recs), true, 4)
+	for _, rounds := range []int{0, 3} {
+		var first *EqCounts
+		for _, workers := range []int{1, 3, 8} {
+			r1, r2 := writePairs(recs, frags, 50)
+			E := I.QuantReader(r1, r2, QuantOptions{Workers: workers, BatchSize: 7, QueueSize: 1, MaxInsert: 500, Rounds: rounds, Seed: 5})
+			if first == nil {
+				first = E
+				// A single round of seeds may miss a few pairs, but no pair
+				// is assigned to a wrong sequence.
+				for k, n := range want {
+					if class := E.Classes[strconv.Itoa(k)]; class == nil || class.Count > n || class.Count < n*98/100 {
+						t.Errorf("%d rounds: sequence %d has %v pairs of %d", rounds, k, class, n)
+					}
+				}
+				if E.Assigned+E.Unassigned != len(frags) || len(E.Classes) != len(want) {
+					t.Errorf("%d rounds: %d of %d pairs assigned to %d classes", rounds, E.Assigned, len(frags), len(E.Classes))
+				}
+			} else if !reflect.DeepEqual(E, first) {
+				t.Errorf("%d rounds: %d workers count differently from 1", rounds, workers)
+			}
+		}
+	}
+}
+
+func TestQuantErrors(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	recs, frags, _ := simulatedLibrary(r)
+	I := CompressedIndex(writeFasta(t, recs), true, 4)
+	r1, r2 := writePairs(recs, frags, 50)
+	r2.Truncate(r2.Len() / 2)
+	if _, err := I.QuantReaderContext(context.Background(), r1, r2, QuantOptions{Workers: 2, BatchSize: 5}, nil); err == nil {
+		t.Error("reads of different numbers of pairs were quantified")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r1, r2 = writePairs(recs, frags, 50)
+	if _, err := I.QuantReaderContext(ctx, r1, r2, QuantOptions{Workers: 2, BatchSize: 5}, nil); err != context.Canceled {
+		t.Errorf("canceled quantification returned %v", err)
+	}
+	if _, err := I.QuantReaderContext(context.Background(), strings.NewReader(""), new(bytes.Buffer), QuantOptions{}, nil); err != nil {
+		t.Errorf("empty reads: %v", err)
+	}
+}
+
+// Reads of at most 20 bases have no random seeds, and some have no bases.
+func TestQuantShortReads(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	same := randSeq(r, 300)
+	recs := []string{same, same, randSeq(r, 300)}
+	var frags []fragment
+	var lens []int
+	for i := 0; i < 200; i++ {
+		k := r.Intn(3)
+		start := r.Intn(100)
+		frags = append(frags, fragment{k, start, start + 150})
+		lens = append(lens, []int{0, 1, 15, 20, 21, 50}[i%6])
+	}
+	var r1, r2 bytes.Buffer
+	for i, f := range frags {
+		a, b := writePairs(recs, []fragment{f}, lens[i])
+		r1.Write(a.Bytes())
+		r2.Write(b.Bytes())
+	}
+	I := CompressedIndex(writeFasta(t, recs), true, 4)
+	for _, rounds := range []int{0, 1, 4} {
+		E := I.QuantReader(bytes.NewReader(r1.Bytes()), bytes.NewReader(r2.Bytes()), QuantOptions{Workers: 3, BatchSize: 16, MaxInsert: 500, Rounds: rounds})
+		if E.Assigned+E.Unassigned != len(frags) {
+			t.Fatalf("%d rounds: %d of %d pairs", rounds, E.Assigned+E.Unassigned, len(frags))
+		}
+		// The copies cannot be told apart, and the pairs of the other
+		// sequence go to it.
+		for key, class := range E.Classes {
+			if len(class.IDs) == 1 && class.IDs[0] != 2 || strings.HasPrefix(key, "1") {
+				t.Errorf("%d rounds: pairs were assigned to %s", rounds, key)
+			}
+		}
+		if class := E.Classes["2"]; class == nil || class.Count < 20 {
+			t.Errorf("%d rounds: %v pairs of sequence 2", rounds, class)
+		}
+	}
+	if out := I.FindGenomeR([]byte("ACG"), []byte(same[:15]), 500, 5); len(out) != 0 {
+		t.Errorf("short reads were assigned to %v", out)
+	}
+}
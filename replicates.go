@@ -0,0 +1,443 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Inferential replicates of abundances, by bootstrap or Gibbs sampling.
+*/
+package fmic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// How replicates are drawn.
+type ReplicateMethod int
+
+const (
+	Bootstrap ReplicateMethod = iota // resample the class counts and rerun EM
+	Gibbs                            // collapsed Gibbs sampling of the assignments of reads
+)
+
+type ReplicateOptions struct {
+	Method   ReplicateMethod
+	N        int   // number of replicates
+	Workers  int   // default: number of CPUs
+	Seed     int64 // replicate r of Bootstrap, and chain c of Gibbs, are seeded by Seed+r or Seed+c
+	Chains   int   // Gibbs: independent chains that share the replicates (default: 4)
+	BurnIn   int   // Gibbs: iterations of each chain before its first sample (default: 100)
+	Thinning int   // Gibbs: iterations between two samples of a chain (default: 16)
+	EM       EMOptions
+}
+
+// Replicates of the estimated number of read pairs of each target.
+type Replicates struct {
+	Method    ReplicateMethod
+	IDs       []string
+	EffLength []float64
+	NumReads  [][]float64 // NumReads[r][k] is that of target k in replicate r
+}
+
+// Magic bytes at the start of saved replicates, and prior of Gibbs.
+const (
+	replicates_magic = "RNAQREP1"
+	gibbs_prior      = 1e-3 // pseudo read pairs of each target
+)
+
+// Bounds of saved replicates, so that ReadReplicates does not allocate
+// what a corrupt header claims.
+const (
+	max_replicate_targets = 1 << 26
+	max_replicates        = 1 << 20
+	max_replicate_id      = 1 << 16 // bytes of an id
+)
+
+//-----------------------------------------------------------------------------
+func (opt ReplicateOptions) withDefaults() ReplicateOptions {
+	if opt.Workers <= 0 {
+		opt.Workers = runtime.NumCPU()
+	}
+	if opt.Chains <= 0 {
+		opt.Chains = 4
+	}
+	if opt.BurnIn <= 0 {
+		opt.BurnIn = 100
+	}
+	if opt.Thinning <= 0 {
+		opt.Thinning = 16
+	}
+	opt.EM = opt.EM.withDefaults()
+	return opt
+}
+
+//-----------------------------------------------------------------------------
+// Draw opt.N replicates of A, which was estimated from E.  They are computed
+// by opt.Workers goroutines, and do not depend on their number.
+//-----------------------------------------------------------------------------
+func (A *Abundance) Replicates(ctx context.Context, E *EqCounts, opt ReplicateOptions) (*Replicates, error) {
+	opt = opt.withDefaults()
+	if opt.N <= 0 {
+		return nil, errors.New("Replicates: the number of replicates must be positive")
+	}
+	if opt.Method != Bootstrap && opt.Method != Gibbs {
+		return nil, fmt.Errorf("Replicates: unknown method %d", opt.Method)
+	}
+	R := &Replicates{Method: opt.Method, IDs: A.IDs, EffLength: A.EffLength, NumReads: make([][]float64, opt.N)}
+
+	// Classes in a fixed order, so that draws only depend on the seed.
+	classes := E.sortedClasses()
+
+	// Each job is a replicate of Bootstrap or a chain of Gibbs.  When ctx is
+	// done, the workers skip the remaining jobs.
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(opt.Workers)
+	for w := 0; w < opt.Workers; w++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				r := rand.New(rand.NewSource(opt.Seed + int64(j)))
+				if opt.Method == Bootstrap {
+					R.NumReads[j] = bootstrap(classes, A.EffLength, r, opt.EM)
+				} else {
+					gibbs(ctx, classes, A, j, r, opt, R.NumReads)
+				}
+			}
+		}()
+	}
+	num_jobs := opt.N
+	if opt.Method == Gibbs {
+		num_jobs = opt.Chains
+	}
+	for j := 0; j < num_jobs && ctx.Err() == nil; j++ {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return R, nil
+}
+
+//-----------------------------------------------------------------------------
+// Resample the read pairs of the classes with replacement, and estimate the
+// abundances of the sample.
+//-----------------------------------------------------------------------------
+func bootstrap(classes []*EqClass, eff_len []float64, r *rand.Rand, opt EMOptions) []float64 {
+	total := 0
+	for _, class := range classes {
+		total += class.Count
+	}
+	sample := make([]*EqClass, 0, len(classes))
+	remaining, mass := total, float64(total)
+	for i, class := range classes {
+		n := binomial(r, remaining, float64(class.Count)/mass)
+		if i == len(classes)-1 {
+			n = remaining
+		}
+		remaining -= n
+		mass -= float64(class.Count)
+		if n > 0 {
+			sample = append(sample, &EqClass{IDs: class.IDs, Count: n})
+		}
+	}
+	return runEM(sample, total, eff_len, opt)
+}
+
+//-----------------------------------------------------------------------------
+// Run chain c of the Gibbs sampler, which fills replicates c, c+Chains, ...
+// Each iteration assigns the read pairs of each class to its targets in
+// proportion to their current rates, then draws the rate of each target
+// from its posterior given the assigned pairs.  Samples are the assigned
+// counts.  The chain starts from the rates of A, and stops when ctx is done.
+//-----------------------------------------------------------------------------
+func gibbs(ctx context.Context, classes []*EqClass, A *Abundance, c int, r *rand.Rand, opt ReplicateOptions, out [][]float64) {
+	n := len(A.EffLength)
+	rate := make([]float64, n)
+	for k := range rate {
+		rate[k] = (A.NumReads[k] + gibbs_prior) / A.EffLength[k]
+	}
+	counts := make([]float64, n)
+	var prob []float64
+	for iter, next := 0, c; next < len(out); iter++ {
+		if ctx.Err() != nil {
+			return
+		}
+		for k := range counts {
+			counts[k] = 0
+		}
+		for _, class := range classes {
+			prob = prob[:0]
+			mass := 0.0
+			for _, id := range class.IDs {
+				prob = append(prob, rate[id])
+				mass += rate[id]
+			}
+			if mass <= 0 {
+				// The rates underflowed; assign the pairs uniformly.
+				for j := range prob {
+					prob[j] = 1
+				}
+				mass = float64(len(prob))
+			}
+			remaining := class.Count
+			for j, id := range class.IDs {
+				m := remaining
+				if j < len(class.IDs)-1 {
+					m = binomial(r, remaining, prob[j]/mass)
+				}
+				counts[id] += float64(m)
+				remaining -= m
+				mass -= prob[j]
+			}
+		}
+		for k := range rate {
+			rate[k] = gamma(r, counts[k]+gibbs_prior) / A.EffLength[k]
+		}
+		if iter >= opt.BurnIn && (iter-opt.BurnIn)%opt.Thinning == 0 {
+			out[next] = append([]float64(nil), counts...)
+			next += opt.Chains
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// A draw from the binomial distribution of n trials of probability p.  With
+// q = min(p, 1-p), it is drawn by inversion if nq < 10, and else by
+// rejection from a Cauchy envelope (Numerical Recipes, 7.3).  Both are exact,
+// so that rare classes are resampled as often as they should be.
+//-----------------------------------------------------------------------------
+func binomial(r *rand.Rand, n int, p float64) int {
+	if p <= 0 || n <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return n
+	}
+	if p > 0.5 {
+		return n - binomial(r, n, 1-p)
+	}
+	mean := float64(n) * p
+	if mean < 10 {
+		return binomialInversion(r, n, p)
+	}
+	en := float64(n)
+	lg := func(x float64) float64 {
+		v, _ := math.Lgamma(x)
+		return v
+	}
+	g, plog, qlog := lg(en+1), math.Log(p), math.Log1p(-p)
+	sq := math.Sqrt(2 * mean * (1 - p))
+	for {
+		y := math.Tan(math.Pi * r.Float64())
+		k := math.Floor(sq*y + mean)
+		if k < 0 || k > en {
+			continue
+		}
+		t := 1.2 * sq * (1 + y*y) * math.Exp(g-lg(k+1)-lg(en-k+1)+k*plog+(en-k)*qlog)
+		if r.Float64() <= t {
+			return int(k)
+		}
+	}
+}
+
+// Walk the probabilities of 0, 1, ... successes until they exceed a uniform
+// draw; the walk takes about np+1 steps.
+func binomialInversion(r *rand.Rand, n int, p float64) int {
+	s := p / (1 - p)
+	a := float64(n+1) * s
+	prob := math.Pow(1-p, float64(n))
+	u := r.Float64()
+	k := 0
+	for u > prob && k < n {
+		u -= prob
+		k++
+		prob *= a/float64(k) - s
+	}
+	return k
+}
+
+//-----------------------------------------------------------------------------
+// A draw from the gamma distribution of the given shape and scale 1, by the
+// method of Marsaglia and Tsang.
+//-----------------------------------------------------------------------------
+func gamma(r *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return gamma(r, shape+1) * math.Pow(r.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// The TPM of each replicate.
+//-----------------------------------------------------------------------------
+func (R *Replicates) TPM() [][]float64 {
+	tpm := make([][]float64, len(R.NumReads))
+	for i, num_reads := range R.NumReads {
+		tpm[i] = computeTPM(num_reads, R.EffLength)
+	}
+	return tpm
+}
+
+//-----------------------------------------------------------------------------
+// Write the mean and the sample variance of the number of read pairs and of
+// the TPM of each target over the replicates.
+//-----------------------------------------------------------------------------
+func (R *Replicates) WriteSummaryTSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Name\tMeanNumReads\tVarNumReads\tMeanTPM\tVarTPM\n")
+	tpm := R.TPM()
+	for k, id := range R.IDs {
+		mean_reads, var_reads := meanVariance(R.NumReads, k)
+		mean_tpm, var_tpm := meanVariance(tpm, k)
+		fmt.Fprintf(bw, "%s\t%.3f\t%.3f\t%.6f\t%.6f\n", id, mean_reads, var_reads, mean_tpm, var_tpm)
+	}
+	return bw.Flush()
+}
+
+func meanVariance(values [][]float64, k int) (float64, float64) {
+	n := float64(len(values))
+	mean := 0.0
+	for _, v := range values {
+		mean += v[k]
+	}
+	mean /= n
+	variance := 0.0
+	for _, v := range values {
+		variance += (v[k] - mean) * (v[k] - mean)
+	}
+	if n > 1 {
+		variance /= n - 1
+	}
+	return mean, variance
+}
+
+//-----------------------------------------------------------------------------
+// Write the replicates gzipped: the magic bytes, the method, the numbers of
+// targets and replicates as uint32, the ids each preceded by its length as a
+// uvarint, the effective lengths as float64, then the number of read pairs
+// of each replicate as float32.  Numbers are little-endian.
+//-----------------------------------------------------------------------------
+func (R *Replicates) WriteBinary(w io.Writer) error {
+	if len(R.IDs) > max_replicate_targets || len(R.NumReads) > max_replicates {
+		return fmt.Errorf("WriteBinary: %d targets and %d replicates, at most %d and %d can be saved", len(R.IDs), len(R.NumReads), max_replicate_targets, max_replicates)
+	}
+	for k, id := range R.IDs {
+		if len(id) > max_replicate_id {
+			return fmt.Errorf("WriteBinary: id %d has %d bytes, at most %d can be saved", k, len(id), max_replicate_id)
+		}
+	}
+	gz := gzip.NewWriter(w)
+	bw := bufio.NewWriter(gz)
+	bw.WriteString(replicates_magic)
+	header := []uint32{uint32(R.Method), uint32(len(R.IDs)), uint32(len(R.NumReads))}
+	if err := binary.Write(bw, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	var buf [binary.MaxVarintLen64]byte
+	for _, id := range R.IDs {
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(id)))])
+		bw.WriteString(id)
+	}
+	if err := binary.Write(bw, binary.LittleEndian, R.EffLength); err != nil {
+		return err
+	}
+	row := make([]float32, len(R.IDs))
+	for _, num_reads := range R.NumReads {
+		for k := range row {
+			row[k] = float32(num_reads[k])
+		}
+		if err := binary.Write(bw, binary.LittleEndian, row); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+//-----------------------------------------------------------------------------
+// Read replicates written by WriteBinary, which must end the stream.
+//-----------------------------------------------------------------------------
+func ReadReplicates(r io.Reader) (*Replicates, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(gz)
+	magic := make([]byte, len(replicates_magic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != replicates_magic {
+		return nil, errors.New("ReadReplicates: not a file of replicates")
+	}
+	var header [3]uint32
+	if err := binary.Read(br, binary.LittleEndian, header[:]); err != nil {
+		return nil, fmt.Errorf("ReadReplicates: %v", err)
+	}
+	if header[1] > max_replicate_targets || header[2] > max_replicates {
+		return nil, fmt.Errorf("ReadReplicates: %d targets and %d replicates, at most %d and %d can be read", header[1], header[2], max_replicate_targets, max_replicates)
+	}
+	R := &Replicates{Method: ReplicateMethod(header[0]), IDs: make([]string, header[1]), EffLength: make([]float64, header[1])}
+	for k := range R.IDs {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("ReadReplicates: %v", err)
+		}
+		if n > max_replicate_id {
+			return nil, fmt.Errorf("ReadReplicates: id %d has %d bytes, at most %d can be read", k, n, max_replicate_id)
+		}
+		id := make([]byte, n)
+		if _, err := io.ReadFull(br, id); err != nil {
+			return nil, fmt.Errorf("ReadReplicates: %v", err)
+		}
+		R.IDs[k] = string(id)
+	}
+	if err := binary.Read(br, binary.LittleEndian, R.EffLength); err != nil {
+		return nil, fmt.Errorf("ReadReplicates: %v", err)
+	}
+	row := make([]float32, len(R.IDs))
+	for i := uint32(0); i < header[2]; i++ {
+		if err := binary.Read(br, binary.LittleEndian, row); err != nil {
+			return nil, fmt.Errorf("ReadReplicates: %v", err)
+		}
+		num_reads := make([]float64, len(row))
+		for k, x := range row {
+			num_reads[k] = float64(x)
+		}
+		R.NumReads = append(R.NumReads, num_reads)
+	}
+	// Reading to the end checks the gzip trailer.
+	if _, err := br.ReadByte(); err != io.EOF {
+		if err == nil {
+			err = errors.New("data after the last replicate")
+		}
+		return nil, fmt.Errorf("ReadReplicates: %v", err)
+	}
+	return R, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,196 @@
+package fmic
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// An index of three targets, classes of 650 pairs over them, and their
+// estimate.
+func replicatesInput(t *testing.T) (*IndexC, *Abundance, *EqCounts) {
+	r := rand.New(rand.NewSource(8))
+	I := buildIndex(t, writeFasta(t, []string{randSeq(r, 1000), randSeq(r, 1500), randSeq(r, 800)}), BuildOptions{Multiple: true, CompressionRatio: 4})
+	E := NewEqCounts()
+	E.Add([]int{0}, 200)
+	E.Add([]int{1}, 300)
+	E.Add([]int{2}, 100)
+	E.Add([]int{0, 1}, 50)
+	return I, I.EstimateAbundance(E, EMOptions{}), E
+}
+
+func TestReplicates(t *testing.T) {
+	_, A, E := replicatesInput(t)
+	for _, method := range []ReplicateMethod{Bootstrap, Gibbs} {
+		opt := ReplicateOptions{Method: method, N: 40, Seed: 3, BurnIn: 20, Thinning: 2}
+		var first *Replicates
+		for _, workers := range []int{1, 3, 8} {
+			opt.Workers = workers
+			R, err := A.Replicates(context.Background(), E, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first == nil {
+				first = R
+			} else if !reflect.DeepEqual(R, first) {
+				t.Fatalf("method %d: replicates with %d workers differ", method, workers)
+			}
+		}
+		R := first
+		if R.Method != method || len(R.NumReads) != opt.N || !reflect.DeepEqual(R.IDs, A.IDs) {
+			t.Fatalf("method %d: %d replicates of %v", method, len(R.NumReads), R.IDs)
+		}
+		// Replicates keep the pairs, and scatter around the estimate.
+		for i, num_reads := range R.NumReads {
+			sum := 0.0
+			for _, x := range num_reads {
+				sum += x
+			}
+			if math.Abs(sum-float64(E.Assigned)) > 1e-6*sum {
+				t.Fatalf("method %d: replicate %d has %f pairs", method, i, sum)
+			}
+		}
+		spread := false
+		for k := range A.IDs {
+			mean, variance := meanVariance(R.NumReads, k)
+			if math.Abs(mean-A.NumReads[k]) > 0.1*A.NumReads[k] || variance > A.NumReads[k]*2 {
+				t.Errorf("method %d: target %d has mean %f and variance %f, estimate %f", method, k, mean, variance, A.NumReads[k])
+			}
+			spread = spread || variance > 0
+		}
+		if !spread {
+			t.Errorf("method %d: the replicates are all the same", method)
+		}
+
+		// Binary round trip, to float32.
+		var buf bytes.Buffer
+		if err := R.WriteBinary(&buf); err != nil {
+			t.Fatal(err)
+		}
+		L, err := ReadReplicates(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if L.Method != R.Method || !reflect.DeepEqual(L.IDs, R.IDs) || !reflect.DeepEqual(L.EffLength, R.EffLength) || len(L.NumReads) != len(R.NumReads) {
+			t.Fatalf("method %d: read back %+v", method, L)
+		}
+		for i := range R.NumReads {
+			for k, x := range R.NumReads[i] {
+				if L.NumReads[i][k] != float64(float32(x)) {
+					t.Fatalf("method %d: replicate %d target %d is %f, want %f", method, i, k, L.NumReads[i][k], x)
+				}
+			}
+		}
+		if _, err := ReadReplicates(bytes.NewReader(buf.Bytes()[:buf.Len()-10])); err == nil {
+			t.Errorf("method %d: truncated replicates were read", method)
+		}
+
+		// The summary has the mean of each target.
+		buf.Reset()
+		if err := R.WriteSummaryTSV(&buf); err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(&buf)
+		sc.Scan()
+		if sc.Text() != "Name\tMeanNumReads\tVarNumReads\tMeanTPM\tVarTPM" {
+			t.Fatalf("header %q", sc.Text())
+		}
+		for k := 0; sc.Scan(); k++ {
+			fields := strings.Split(sc.Text(), "\t")
+			mean, _ := meanVariance(R.NumReads, k)
+			x, err := strconv.ParseFloat(fields[1], 64)
+			if len(fields) != 5 || fields[0] != R.IDs[k] || err != nil || math.Abs(x-mean) > 1e-3 {
+				t.Fatalf("line %q, mean %f", sc.Text(), mean)
+			}
+		}
+	}
+}
+
+func TestReplicatesErrors(t *testing.T) {
+	_, A, E := replicatesInput(t)
+	if _, err := A.Replicates(context.Background(), E, ReplicateOptions{}); err == nil {
+		t.Error("no replicates were drawn")
+	}
+	if _, err := A.Replicates(context.Background(), E, ReplicateOptions{Method: 2, N: 1}); err == nil {
+		t.Error("replicates of an unknown method were drawn")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, method := range []ReplicateMethod{Bootstrap, Gibbs} {
+		if _, err := A.Replicates(ctx, E, ReplicateOptions{Method: method, N: 4}); err != context.Canceled {
+			t.Errorf("method %d: %v", method, err)
+		}
+	}
+	if _, err := ReadReplicates(strings.NewReader("RNAQREP1")); err == nil {
+		t.Error("replicates were read without gzip")
+	}
+	for _, header := range [][]uint32{{0, 1 << 30, 1}, {0, 1, 1 << 30}, {0, 1, 1, 1 << 30}} {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(replicates_magic))
+		binary.Write(gz, binary.LittleEndian, header[:3])
+		if len(header) > 3 {
+			var id [binary.MaxVarintLen64]byte
+			gz.Write(id[:binary.PutUvarint(id[:], uint64(header[3]))])
+		}
+		gz.Close()
+		if _, err := ReadReplicates(&buf); err == nil || !strings.Contains(err.Error(), "at most") {
+			t.Errorf("header %v: %v", header, err)
+		}
+	}
+}
+
+func TestBinomial(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for _, c := range []struct {
+		n int
+		p float64
+	}{{10, 0.5}, {100000, 1e-5}, {1000, 0.3}, {5000, 0.999}, {1 << 30, 0.25}} {
+		const draws = 20000
+		values := make([][]float64, draws)
+		for i := range values {
+			k := binomial(r, c.n, c.p)
+			if k < 0 || k > c.n {
+				t.Fatalf("%d trials of %g: %d", c.n, c.p, k)
+			}
+			values[i] = []float64{float64(k)}
+		}
+		mean, variance := meanVariance(values, 0)
+		want_mean, want_var := float64(c.n)*c.p, float64(c.n)*c.p*(1-c.p)
+		if math.Abs(mean-want_mean) > 4*math.Sqrt(want_var/draws) || math.Abs(variance-want_var) > 0.1*want_var {
+			t.Errorf("%d trials of %g: mean %f and variance %f, want %f and %f", c.n, c.p, mean, variance, want_mean, want_var)
+		}
+	}
+}
+
+// A class of a single pair among 100000 is resampled as a Poisson count.
+func TestBootstrapRareClass(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	I := buildIndex(t, writeFasta(t, []string{randSeq(r, 1000), randSeq(r, 1000)}), BuildOptions{Multiple: true, CompressionRatio: 4})
+	E := NewEqCounts()
+	E.Add([]int{0}, 1)
+	E.Add([]int{1}, 99999)
+	A := I.EstimateAbundance(E, EMOptions{})
+	R, err := A.Replicates(context.Background(), E, ReplicateOptions{Method: Bootstrap, N: 4000, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeros := 0
+	for _, num_reads := range R.NumReads {
+		if num_reads[0] < 0.5 {
+			zeros++
+		}
+	}
+	mean, variance := meanVariance(R.NumReads, 0)
+	if math.Abs(mean-1) > 0.1 || math.Abs(variance-1) > 0.15 || math.Abs(float64(zeros)/4000-math.Exp(-1)) > 0.025 {
+		t.Errorf("mean %f, variance %f, %d of 4000 replicates without the pair", mean, variance, zeros)
+	}
+}
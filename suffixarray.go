@@ -0,0 +1,82 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Suffix arrays of texts over integer alphabets.
+*/
+package fmic
+
+import (
+	"fmt"
+)
+
+//-----------------------------------------------------------------------------
+// Compute the suffix array of text, whose values must be in [0, k), storing
+// it into SA.  len(text) and len(SA) must be equal.  As with
+// ComputeSuffixArray, a suffix comes before the longer suffixes that it is a
+// prefix of.  Besides text and SA, this takes len(text)+k+1 words of memory.
+//-----------------------------------------------------------------------------
+func ComputeSuffixArrayInt(text []int, k int, SA []int) {
+	if len(text) != len(SA) {
+		panic(fmt.Sprintf("ComputeSuffixArrayInt: text has length %d but SA has length %d", len(text), len(SA)))
+	}
+	S := make([]int, len(text))
+	copy(S, text)
+	computeSuffixArrayInt(S, k, SA)
+}
+
+//-----------------------------------------------------------------------------
+// Same as ComputeSuffixArrayInt, for texts and suffix arrays of int32.  It
+// takes 2*len(text)+k+1 words of memory besides text and SA.
+//-----------------------------------------------------------------------------
+func ComputeSuffixArrayInt32(text []int32, k int, SA []int32) {
+	if len(text) != len(SA) {
+		panic(fmt.Sprintf("ComputeSuffixArrayInt32: text has length %d but SA has length %d", len(text), len(SA)))
+	}
+	S := make([]int, len(text))
+	for i, c := range text {
+		S[i] = int(c)
+	}
+	SA1 := make([]int, len(SA))
+	computeSuffixArrayInt(S, k, SA1)
+	for i, s := range SA1 {
+		SA[i] = int32(s)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Rename the characters of S the way the recursive levels of SA-IS expect:
+// an L-type character becomes the head of its bucket in SA, and an S-type
+// character the bitwise negation of the tail of its bucket.  Then S can be
+// sorted by computeSuffixArray1.
+//-----------------------------------------------------------------------------
+func computeSuffixArrayInt(S []int, k int, SA []int) {
+	n := len(S)
+	if n == 0 {
+		return
+	}
+	heads := make([]int, k+1)
+	for i, c := range S {
+		if c < 0 || c >= k {
+			panic(fmt.Sprintf("suffix array: text[%d] = %d is not in [0,%d)", i, c, k))
+		}
+		heads[c+1]++
+	}
+	for c := 1; c <= k; c++ {
+		heads[c] += heads[c-1]
+	}
+
+	// S[n-1] is L-type because of the (virtual) sentinel.
+	next, next_s := -1, false
+	for i := n - 1; i >= 0; i-- {
+		c := S[i]
+		s_type := c < next || (c == next && next_s)
+		if s_type {
+			S[i] = ^(heads[c+1] - 1)
+		} else {
+			S[i] = heads[c]
+		}
+		next, next_s = c, s_type
+	}
+	computeSuffixArray1(S, SA, k)
+}
+
+//-----------------------------------------------------------------------------
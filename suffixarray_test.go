@@ -0,0 +1,77 @@
+package fmic
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestComputeSuffixArrayInt(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for trial := 0; trial < 2000; trial++ {
+		n, k := r.Intn(60), 1+r.Intn(6)
+		if trial%5 == 0 {
+			k = 1 + r.Intn(1000)
+		}
+		text := make([]int, n)
+		for i := range text {
+			text[i] = r.Intn(k)
+		}
+		// Repeats make deeper recursions.
+		if trial%7 == 0 {
+			copy(text[n/2:], text)
+		}
+		text32 := make([]int32, n)
+		for i, c := range text {
+			text32[i] = int32(c)
+		}
+		want := naiveSuffixArray(text)
+		SA, SA32 := make([]int, n), make([]int32, n)
+		ComputeSuffixArrayInt(text, k, SA)
+		ComputeSuffixArrayInt32(text32, k, SA32)
+		for i, p := range want {
+			if SA[i] != p || int(SA32[i]) != p {
+				t.Fatalf("suffix array of %v is %v and %v instead of %v", text, SA, SA32, want)
+			}
+		}
+	}
+}
+
+func TestComputeSuffixArrayIntBytes(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	S := []byte(randSeq(r, 5000) + "$")
+	text := make([]int, len(S))
+	for i, c := range S {
+		text[i] = int(c)
+	}
+	SA, SA0 := make([]int, len(S)), make([]int, len(S))
+	ComputeSuffixArrayInt(text, 256, SA)
+	new(WorkSpace).ComputeSuffixArray(S, SA0)
+	for i := range SA {
+		if SA[i] != SA0[i] {
+			t.Fatalf("SA[%d] is %d over ints and %d over bytes", i, SA[i], SA0[i])
+		}
+	}
+	// text is not changed.
+	for i, c := range S {
+		if text[i] != int(c) {
+			t.Fatalf("text[%d] was changed", i)
+		}
+	}
+}
+
+func TestComputeSuffixArrayIntPanics(t *testing.T) {
+	for k, f := range []func(){
+		func() { ComputeSuffixArrayInt([]int{0, 1}, 2, make([]int, 3)) },
+		func() { ComputeSuffixArrayInt([]int{0, 2}, 2, make([]int, 2)) },
+		func() { ComputeSuffixArrayInt32([]int32{-1}, 2, make([]int32, 1)) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("case %d did not panic", k)
+				}
+			}()
+			f()
+		}()
+	}
+}
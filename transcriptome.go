@@ -0,0 +1,220 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Transcriptome index built from a genome and its annotation.
+*/
+package fmic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type transcript struct {
+	id      string
+	gene    string
+	name    string // gene name
+	biotype string
+	seqname string
+	strand  byte
+	exons   [][2]int // 1-based, inclusive
+}
+
+//-----------------------------------------------------------------------------
+// Build the FM index of the transcripts annotated in gtf_file, spliced from
+// the sequences in genome_file.  Transcripts on the minus strand are
+// reverse-complemented.  GENOME_ID holds the transcript ids and GENOME_DES
+// their gene, gene name and biotype.  The index is saved to gtf_file.fmi.
+//-----------------------------------------------------------------------------
+func CompressedTranscriptomeIndex(genome_file, gtf_file string, compression_ratio int) *IndexC {
+	opt := BuildOptions{CompressionRatio: compression_ratio, ISARate: compression_ratio}
+	I, err := CompressedTranscriptomeIndexContext(context.Background(), genome_file, gtf_file, opt, nil)
+	check_for_error(err)
+	return I
+}
+
+//-----------------------------------------------------------------------------
+func CompressedTranscriptomeIndexContext(ctx context.Context, genome_file, gtf_file string, opt BuildOptions, progress Progress) (*IndexC, error) {
+	progress = orNoProgress(progress)
+	opt.Multiple = true
+	I, err := newIndex(gtf_file, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Phase(PhaseReadFasta)
+	transcripts, err := readTranscripts(gtf_file)
+	if err != nil {
+		return nil, err
+	}
+	if err = I.checkNumSequences(len(transcripts)); err != nil {
+		return nil, err
+	}
+	genome, err := readGenome(ctx, genome_file, progress)
+	if err != nil {
+		return nil, err
+	}
+	text := &textBuilder{I: I}
+	for _, t := range transcripts {
+		seq, err := t.splice(genome[t.seqname])
+		if err != nil {
+			return nil, err
+		}
+		if err = text.add(t.id, t.description(), seq); err != nil {
+			return nil, err
+		}
+	}
+	text.finish()
+
+	if err = I.build(ctx, progress); err != nil {
+		return nil, err
+	}
+	return I, nil
+}
+
+//-----------------------------------------------------------------------------
+// Collect the exons of each transcript, in the order transcripts first
+// appear in the annotation.
+//-----------------------------------------------------------------------------
+func readTranscripts(gtf_file string) ([]*transcript, error) {
+	f, err := os.Open(gtf_file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var transcripts []*transcript
+	byID := make(map[string]*transcript)
+	get := func(id string) *transcript {
+		t, ok := byID[id]
+		if !ok {
+			t = &transcript{id: id}
+			byID[id] = t
+			transcripts = append(transcripts, t)
+		}
+		return t
+	}
+	err = ReadGTF(f, func(rec *GTFRecord) error {
+		if tid, gid := rec.TranscriptGene(); tid != "" {
+			t := get(tid)
+			t.gene = gid
+			if name, ok := rec.Attr["gene_name"]; ok {
+				t.name = name
+			}
+			for _, key := range []string{"transcript_biotype", "transcript_type", "biotype"} {
+				if biotype, ok := rec.Attr[key]; ok {
+					t.biotype = biotype
+					break
+				}
+			}
+		}
+		if rec.Feature != "exon" {
+			return nil
+		}
+		tid, ok := rec.Attr["transcript_id"]
+		if !ok {
+			tid = strings.TrimPrefix(rec.Attr["Parent"], "transcript:")
+		}
+		if tid == "" {
+			return fmt.Errorf("readTranscripts: exon at %s:%d has no transcript", rec.Seqname, rec.Start)
+		}
+		t := get(tid)
+		if t.seqname != "" && (t.seqname != rec.Seqname || t.strand != rec.Strand) {
+			return fmt.Errorf("readTranscripts: exons of %s are on different sequences or strands", tid)
+		}
+		t.seqname, t.strand = rec.Seqname, rec.Strand
+		t.exons = append(t.exons, [2]int{rec.Start, rec.End})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only the transcripts with exons.
+	out := transcripts[:0]
+	for _, t := range transcripts {
+		if len(t.exons) > 0 {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+//-----------------------------------------------------------------------------
+// Description in the style of Ensembl transcriptome fasta headers.
+//-----------------------------------------------------------------------------
+func (t *transcript) description() string {
+	des := fmt.Sprintf("%s:%d-%d:%c", t.seqname, t.exons[0][0], t.exons[len(t.exons)-1][1], t.strand)
+	if t.gene != "" {
+		des += " gene:" + t.gene
+	}
+	if t.name != "" {
+		des += " gene_symbol:" + t.name
+	}
+	if t.biotype != "" {
+		des += " transcript_biotype:" + t.biotype
+	}
+	return des
+}
+
+//-----------------------------------------------------------------------------
+func (t *transcript) splice(chrom []byte) ([]byte, error) {
+	if chrom == nil {
+		return nil, fmt.Errorf("splice: %s is on %s, which is not in the genome", t.id, t.seqname)
+	}
+	sort.Slice(t.exons, func(i, j int) bool { return t.exons[i][0] < t.exons[j][0] })
+	var seq []byte
+	for _, e := range t.exons {
+		if e[0] < 1 || e[1] > len(chrom) || e[0] > e[1] {
+			return nil, fmt.Errorf("splice: exon %d-%d of %s is outside %s", e[0], e[1], t.id, t.seqname)
+		}
+		seq = append(seq, chrom[e[0]-1:e[1]]...)
+	}
+	if t.strand == '-' {
+		reverseComplement(seq)
+	}
+	return seq, nil
+}
+
+//-----------------------------------------------------------------------------
+// Read all sequences of a genome fasta file, keyed by their ids.
+//-----------------------------------------------------------------------------
+func readGenome(ctx context.Context, file string, progress Progress) (map[string][]byte, error) {
+	genome := make(map[string][]byte)
+	err := readFastaRecords(ctx, file, progress, func(id, des string, seq []byte) error {
+		genome[id] = seq
+		return nil
+	})
+	return genome, err
+}
+
+//-----------------------------------------------------------------------------
+func reverse(s []byte) {
+	for left, right := 0, len(s)-1; left < right; left, right = left+1, right-1 {
+		s[left], s[right] = s[right], s[left]
+	}
+}
+
+//-----------------------------------------------------------------------------
+var complement = [256]byte{}
+
+func init() {
+	for i := range complement {
+		complement[i] = byte(i)
+	}
+	pairs := []string{"AT", "CG", "RY", "KM", "BV", "DH", "at", "cg", "ry", "km", "bv", "dh"}
+	for _, p := range pairs {
+		complement[p[0]], complement[p[1]] = p[1], p[0]
+	}
+}
+
+func reverseComplement(s []byte) {
+	reverse(s)
+	for i := range s {
+		s[i] = complement[s[i]]
+	}
+}
+
+//-----------------------------------------------------------------------------
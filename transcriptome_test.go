@@ -0,0 +1,62 @@
+package fmic
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscriptomeIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	chr := randSeq(r, 1000)
+	dir := t.TempDir()
+	genome, gtf := filepath.Join(dir, "genome.fa"), filepath.Join(dir, "genes.gtf")
+	if err := os.WriteFile(genome, []byte(">chr1 x\n"+chr[:500]+"\n"+chr[500:]+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	annotation := "chr1\tx\texon\t11\t20\t.\t+\t.\tgene_id \"g1\"; transcript_id \"ta\"; gene_name \"A\"; transcript_type \"pc\";\n" +
+		"chr1\tx\texon\t101\t150\t.\t+\t.\tgene_id \"g1\"; transcript_id \"ta\";\n" +
+		"chr1\tx\texon\t301\t320\t.\t-\t.\tgene_id \"g2\"; transcript_id \"tb\";\n" +
+		"chr1\tx\texon\t201\t210\t.\t-\t.\tgene_id \"g2\"; transcript_id \"tb\";\n"
+	if err := os.WriteFile(gtf, []byte(annotation), 0666); err != nil {
+		t.Fatal(err)
+	}
+	I, err := CompressedTranscriptomeIndexContext(context.Background(), genome, gtf, BuildOptions{CompressionRatio: 4, ISARate: 4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ta := chr[10:20] + chr[100:150]
+	tb := []byte(chr[200:210] + chr[300:320])
+	reverseComplement(tb)
+	if got := string(I.Extract(0, 0, I.LENS[0])); got != ta {
+		t.Errorf("ta is %s instead of %s", got, ta)
+	}
+	if got := string(I.Extract(1, 0, I.LENS[1])); got != string(tb) {
+		t.Errorf("tb is %s instead of %s", got, tb)
+	}
+	if des := I.GENOME_DES[0]; des != "chr1:11-150:+ gene:g1 gene_symbol:A transcript_biotype:pc" {
+		t.Errorf("ta is described as %q", des)
+	}
+	if strings.Join(I.GENOME_ID, " ") != "ta tb" {
+		t.Errorf("ids %v", I.GENOME_ID)
+	}
+
+	// The same transcripts from a fasta file give the same index.
+	fasta := filepath.Join(dir, "tx.fasta")
+	if err := os.WriteFile(fasta, []byte(">ta x\n"+ta+"\n>tb x\n"+string(tb)+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sameIndex(t, I, CompressedIndexSampled(fasta, true, 4, 4))
+
+	// Exons on a sequence the genome lacks.
+	if err := os.WriteFile(gtf, []byte(strings.Replace(annotation, "chr1", "chr2", 1)), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompressedTranscriptomeIndexContext(context.Background(), genome, gtf, BuildOptions{CompressionRatio: 4, ISARate: 4}, nil); err == nil {
+		t.Error("a transcript of an unknown sequence was built")
+	}
+}
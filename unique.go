@@ -0,0 +1,180 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Positions whose L-mers identify a single sequence.
+*/
+package fmic
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Which L-mers of an index occur in only one sequence.
+type UniqueTrack struct {
+	L    int
+	I    *IndexC
+	bits BitVector // bits[p] is set if the L-mer at position p of SEQ is unique
+}
+
+//-----------------------------------------------------------------------------
+// Find the L-mers that occur in only one sequence, possibly several times.
+// The rows of an L-mer are consecutive, with LCP >= L between them, so it is
+// unique if SequenceOf is the same for all of them.  The index needs its LCP
+// array and a suffix array, but not SEQ.
+//-----------------------------------------------------------------------------
+func (I *IndexC) UniqueLmers(ctx context.Context, L int) (*UniqueTrack, error) {
+	if L < 1 {
+		return nil, fmt.Errorf("UniqueLmers: L must be positive, not %d", L)
+	}
+	if I.LCP.Len() != I.LEN || I.SA.Len() == 0 {
+		return nil, errors.New("UniqueLmers: the index needs an LCP array and a suffix array")
+	}
+	U := &UniqueTrack{L: L, I: I, bits: NewBitVector(I.LEN)}
+	start := indexType(0)
+	for i := indexType(1); i <= I.LEN; i++ {
+		if i%check_interval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if i < I.LEN && I.LCP.Get(i) >= indexType(L) {
+			continue
+		}
+		U.markRows(start, i)
+		start = i
+	}
+	return U, nil
+}
+
+//-----------------------------------------------------------------------------
+// Rows [start, end) hold all occurences of an L-mer, or a single suffix that
+// may be too short to have one.
+//-----------------------------------------------------------------------------
+func (U *UniqueTrack) markRows(start, end indexType) {
+	I := U.I
+	if end-start == 1 {
+		p := I.Locate(start)
+		if p == I.LEN-1 {
+			return // the suffix "$"
+		}
+		g := I.LEN - 2 - p // the L-mer ends at g in the original text
+		k := I.sequenceAt(g)
+		if g >= I.offsets[k]+I.LENS[k] || g+1 < I.offsets[k]+indexType(U.L) {
+			return // a separator, or fewer than L characters
+		}
+		U.bits.Set(p)
+		return
+	}
+	id := I.SequenceOf(start)
+	for i := start + 1; i < end; i++ {
+		if I.SequenceOf(i) != id {
+			return
+		}
+	}
+	for i := start; i < end; i++ {
+		U.bits.Set(I.Locate(i))
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Number of L-mers of sequence seqID.
+//-----------------------------------------------------------------------------
+func (U *UniqueTrack) NumLmers(seqID int) indexType {
+	if n := U.I.LENS[seqID] - indexType(U.L) + 1; n > 0 {
+		return n
+	}
+	return 0
+}
+
+//-----------------------------------------------------------------------------
+// Whether the L-mer that starts at position x of sequence seqID, in the
+// orientation of the input fasta file, occurs in that sequence only.
+//-----------------------------------------------------------------------------
+func (U *UniqueTrack) IsUnique(seqID int, x indexType) bool {
+	if x < 0 || x >= U.NumLmers(seqID) {
+		panic(fmt.Sprintf("IsUnique: sequence %d has no %d-mer at %d", seqID, U.L, x))
+	}
+	return U.bits.Get(U.I.LEN - 1 - U.I.offsets[seqID] - x - indexType(U.L))
+}
+
+//-----------------------------------------------------------------------------
+// Fraction of the L-mers of sequence seqID that are unique; 0 if it has none.
+//-----------------------------------------------------------------------------
+func (U *UniqueTrack) UniqueFraction(seqID int) float64 {
+	n := U.NumLmers(seqID)
+	if n == 0 {
+		return 0
+	}
+	unique := 0
+	for x := indexType(0); x < n; x++ {
+		if U.IsUnique(seqID, x) {
+			unique++
+		}
+	}
+	return float64(unique) / float64(n)
+}
+
+//-----------------------------------------------------------------------------
+// Write the number of L-mers and the unique fraction of each sequence.
+//-----------------------------------------------------------------------------
+func (U *UniqueTrack) WriteFractions(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Name\tLength\tNumLmers\tUniqueFraction\n")
+	for k, id := range U.I.GENOME_ID {
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%.6f\n", id, U.I.LENS[k], U.NumLmers(k), U.UniqueFraction(k))
+	}
+	return bw.Flush()
+}
+
+//-----------------------------------------------------------------------------
+// Write a bedGraph track, in which each position where an L-mer starts has
+// value 1 if the L-mer is unique and 0 otherwise.  Runs of equal values are
+// merged; coordinates are 0-based and half-open.
+//-----------------------------------------------------------------------------
+func (U *UniqueTrack) WriteBedGraph(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "track type=bedGraph name=\"unique %d-mers\"\n", U.L)
+	for k, id := range U.I.GENOME_ID {
+		n := U.NumLmers(k)
+		for start := indexType(0); start < n; {
+			unique := U.IsUnique(k, start)
+			end := start + 1
+			for end < n && U.IsUnique(k, end) == unique {
+				end++
+			}
+			value := 0
+			if unique {
+				value = 1
+			}
+			fmt.Fprintf(bw, "%s\t%d\t%d\t%d\n", id, start, end, value)
+			start = end
+		}
+	}
+	return bw.Flush()
+}
+
+//-----------------------------------------------------------------------------
+// Write the same values as a fixedStep wiggle track, with 1-based positions.
+//-----------------------------------------------------------------------------
+func (U *UniqueTrack) WriteWiggle(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "track type=wiggle_0 name=\"unique %d-mers\"\n", U.L)
+	for k, id := range U.I.GENOME_ID {
+		n := U.NumLmers(k)
+		if n == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "fixedStep chrom=%s start=1 step=1\n", id)
+		for x := indexType(0); x < n; x++ {
+			if U.IsUnique(k, x) {
+				fmt.Fprintln(bw, 1)
+			} else {
+				fmt.Fprintln(bw, 0)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,84 @@
+package fmic
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUniqueLmers(t *testing.T) {
+	r := rand.New(rand.NewSource(14))
+	rep := randSeq(r, 60)
+	recs := []string{randSeq(r, 200) + rep + randSeq(r, 50), rep + rep, randSeq(r, 3), strings.Repeat("A", 40), randSeq(r, 100) + "AAAAAAAAAAAA"}
+	file := writeFasta(t, recs)
+	for _, opt := range []BuildOptions{
+		{Multiple: true, CompressionRatio: 4, LCP: true},
+		{Multiple: true, CompressionRatio: 4, LCP: true, NoSSA: true},
+	} {
+		I := buildIndex(t, file, opt)
+		if err := I.SaveCompressedIndexContext(context.Background(), 1, nil); err != nil {
+			t.Fatal(err)
+		}
+		// The loaded index has no SEQ.
+		J, err := LoadCompressedIndexContext(context.Background(), file+".fmi", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, L := range []int{1, 5, 12, 30} {
+			for _, X := range []*IndexC{I, J} {
+				U, err := X.UniqueLmers(context.Background(), L)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for k, rec := range recs {
+					n := len(rec) - L + 1
+					if n < 0 {
+						n = 0
+					}
+					if int(U.NumLmers(k)) != n {
+						t.Errorf("sequence %d has %d %d-mers instead of %d", k, U.NumLmers(k), L, n)
+					}
+					for x := 0; x+L <= len(rec); x++ {
+						want := true
+						for k2, rec2 := range recs {
+							if k2 != k && strings.Contains(rec2, rec[x:x+L]) {
+								want = false
+							}
+						}
+						if U.IsUnique(k, indexType(x)) != want {
+							t.Fatalf("%+v: the %d-mer at %d of %d is unique: %t", opt, L, x, k, !want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestUniqueTrackOutput(t *testing.T) {
+	file := writeFasta(t, []string{"ACGTT", "CGTA", "A"})
+	I := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4, LCP: true})
+	U, err := I.UniqueLmers(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ACG, CGT, GTT of t0; CGT, GTA of t1.
+	var bed, wig, fractions bytes.Buffer
+	U.WriteBedGraph(&bed)
+	U.WriteWiggle(&wig)
+	U.WriteFractions(&fractions)
+	for _, c := range []struct{ got, want string }{
+		{bed.String(), "track type=bedGraph name=\"unique 3-mers\"\nt0\t0\t1\t1\nt0\t1\t2\t0\nt0\t2\t3\t1\nt1\t0\t1\t0\nt1\t1\t2\t1\n"},
+		{wig.String(), "track type=wiggle_0 name=\"unique 3-mers\"\nfixedStep chrom=t0 start=1 step=1\n1\n0\n1\nfixedStep chrom=t1 start=1 step=1\n0\n1\n"},
+		{fractions.String(), "Name\tLength\tNumLmers\tUniqueFraction\nt0\t5\t3\t0.666667\nt1\t4\t2\t0.500000\nt2\t1\t0\t0.000000\n"},
+	} {
+		if c.got != c.want {
+			t.Errorf("wrote\n%s\ninstead of\n%s", c.got, c.want)
+		}
+	}
+	if _, err := buildIndex(t, file, BuildOptions{Multiple: true, CompressionRatio: 4}).UniqueLmers(context.Background(), 3); err == nil {
+		t.Error("unique L-mers were found without LCP")
+	}
+}
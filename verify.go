@@ -0,0 +1,415 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Verification of the invariants of an index.
+*/
+package fmic
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Problems reported per check; the rest are only counted.
+const max_problems = 10
+
+//-----------------------------------------------------------------------------
+// Options of Verify.
+//-----------------------------------------------------------------------------
+type VerifyOptions struct {
+	Records int   // records to reconstruct by LF-walking and compare with SEQ
+	Seed    int64 // seed of the choice of records
+}
+
+//-----------------------------------------------------------------------------
+// The outcome of one check of Verify.  A check is skipped if the index lacks
+// what it needs, such as a suffix array.
+//-----------------------------------------------------------------------------
+type CheckResult struct {
+	Name     string
+	Skipped  string   // why the check was skipped, if it was
+	Problems []string // the first max_problems problems
+	More     int      // the number of other problems
+}
+
+func (r *CheckResult) problem(format string, args ...interface{}) {
+	if len(r.Problems) < max_problems {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	} else {
+		r.More++
+	}
+}
+
+// Whether the check found no problems.
+func (r *CheckResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+//-----------------------------------------------------------------------------
+// Check the invariants of the index: the count tables, the BWT, the OCC
+// checkpoints, the sequence lengths, the suffix array and the sequence ids,
+// and reconstruct random records from the BWT to compare them with SEQ.
+// A check that panics on a broken index reports the panic as a problem.
+// The error is only set if ctx is done.
+//-----------------------------------------------------------------------------
+func (I *IndexC) Verify(ctx context.Context, opt VerifyOptions) ([]CheckResult, error) {
+	checks := []struct {
+		name  string
+		check func(ctx context.Context, r *CheckResult, opt VerifyOptions) error
+	}{
+		{"tables", I.verifyTables},
+		{"bwt", I.verifyBWT},
+		{"occ", I.verifyOCC},
+		{"lengths", I.verifyLengths},
+		{"sa", I.verifySA},
+		{"ssa", I.verifySSA},
+		{"records", I.verifyRecords},
+	}
+	var results []CheckResult
+	for _, c := range checks {
+		r := CheckResult{Name: c.name}
+		err := func() (err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					r.problem("the check failed: %v", e)
+				}
+			}()
+			return c.check(ctx, &r, opt)
+		}()
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+//-----------------------------------------------------------------------------
+// C[c] counts the symbols before c, EP[c] is the last row of c, and the
+// frequencies add up to LEN.
+//-----------------------------------------------------------------------------
+func (I *IndexC) verifyTables(ctx context.Context, r *CheckResult, opt VerifyOptions) error {
+	if !sort.IntsAreSorted(I.SYMBOLS) {
+		r.problem("SYMBOLS are not sorted")
+	}
+	var total indexType
+	for j, s := range I.SYMBOLS {
+		c := byte(s)
+		if j > 0 && s == I.SYMBOLS[j-1] {
+			r.problem("symbol %q is repeated", c)
+		}
+		if _, ok := I.OCC[c]; !ok {
+			r.problem("symbol %q has no OCC", c)
+		}
+		if I.C[c] != total {
+			r.problem("C[%q] is %d, but %d symbols come before it", c, I.C[c], total)
+		}
+		// Building leaves EP unset for the first symbol.
+		if ep, ok := I.EP[c]; (ok || j > 0) && ep != I.C[c]+I.Freq[c]-1 {
+			r.problem("EP[%q] is %d instead of %d", c, ep, I.C[c]+I.Freq[c]-1)
+		}
+		total += I.Freq[c]
+	}
+	if len(I.Freq) != len(I.SYMBOLS) || len(I.C) != len(I.SYMBOLS) {
+		r.problem("%d symbols, but %d frequencies and %d counts", len(I.SYMBOLS), len(I.Freq), len(I.C))
+	}
+	if total != I.LEN {
+		r.problem("frequencies add up to %d instead of LEN %d", total, I.LEN)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// The BWT has LEN symbols with frequencies Freq, and one '$' at END_POS.
+//-----------------------------------------------------------------------------
+func (I *IndexC) verifyBWT(ctx context.Context, r *CheckResult, opt VerifyOptions) error {
+	if indexType(len(I.BWT)) != I.LEN {
+		r.problem("BWT has %d symbols instead of %d", len(I.BWT), I.LEN)
+	}
+	count := make(map[byte]indexType)
+	for j, c := range I.BWT {
+		if j%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		count[c]++
+		if c == '$' && indexType(j) != I.END_POS {
+			r.problem("BWT has '$' at %d, but END_POS is %d", j, I.END_POS)
+		}
+	}
+	for _, s := range I.SYMBOLS {
+		if c := byte(s); count[c] != I.Freq[c] {
+			r.problem("BWT has %d of %q, but Freq is %d", count[c], c, I.Freq[c])
+		}
+	}
+	for c := range count {
+		if _, ok := I.Freq[c]; !ok {
+			r.problem("BWT has unknown symbol %q", c)
+		}
+	}
+	if I.END_POS < 0 || I.END_POS >= indexType(len(I.BWT)) || I.BWT[I.END_POS] != '$' {
+		r.problem("END_POS %d does not point at '$'", I.END_POS)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Every OCC checkpoint counts the symbols of the BWT up to it, and the
+// counts of the whole BWT are the frequencies.
+//-----------------------------------------------------------------------------
+func (I *IndexC) verifyOCC(ctx context.Context, r *CheckResult, opt VerifyOptions) error {
+	if I.M <= 0 {
+		r.problem("compression ratio M is %d", I.M)
+		return nil
+	}
+	// The build keeps a checkpoint past the last row that is a multiple of M.
+	if size := I.LEN/indexType(I.M) + 1; I.OCC_SIZE != size {
+		r.problem("OCC_SIZE is %d instead of %d", I.OCC_SIZE, size)
+	}
+	for c, occ := range I.OCC {
+		if occ.Len() != I.OCC_SIZE {
+			r.problem("OCC[%q] has %d checkpoints instead of %d", c, occ.Len(), I.OCC_SIZE)
+		}
+	}
+	if len(r.Problems) > 0 {
+		return nil
+	}
+	if indexType(len(I.BWT)) != I.LEN {
+		r.Skipped = "the BWT has the wrong length"
+		return nil
+	}
+
+	count := make(map[byte]indexType)
+	for j := indexType(0); j < I.LEN; j++ {
+		if j%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		count[I.BWT[j]]++
+		if j%indexType(I.M) == 0 {
+			for c, occ := range I.OCC {
+				if v := occ.Get(j / indexType(I.M)); v != count[c] {
+					r.problem("OCC[%q][%d] is %d instead of %d", c, j/indexType(I.M), v, count[c])
+				}
+			}
+		}
+	}
+	if I.LEN > 0 {
+		for c := range I.OCC {
+			if n := I.Occurence(c, I.LEN-1); n != I.Freq[c] {
+				r.problem("%q occurs %d times in the BWT, but Freq is %d", c, n, I.Freq[c])
+			}
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// The sequences and the '|' between them, followed by '$', make up LEN.
+//-----------------------------------------------------------------------------
+func (I *IndexC) verifyLengths(ctx context.Context, r *CheckResult, opt VerifyOptions) error {
+	n := len(I.LENS)
+	if len(I.GENOME_ID) != n || len(I.GENOME_DES) != n {
+		r.problem("%d lengths, %d ids and %d descriptions", n, len(I.GENOME_ID), len(I.GENOME_DES))
+	}
+	if n == 0 {
+		r.problem("the index has no sequences")
+		return nil
+	}
+	var total indexType
+	for k, l := range I.LENS {
+		if l <= 0 {
+			r.problem("sequence %d has length %d", k, l)
+		}
+		total += l
+	}
+	if total+indexType(n) != I.LEN {
+		r.problem("lengths add up to %d; with %d separators and '$', that is %d instead of LEN %d", total, n-1, total+indexType(n), I.LEN)
+	}
+	if I.Freq['|'] != indexType(n-1) {
+		r.problem("%d sequences, but %d separators", n, I.Freq['|'])
+	}
+	if len(I.SEQ) > 0 {
+		if indexType(len(I.SEQ)) != I.LEN || I.SEQ[len(I.SEQ)-1] != '$' {
+			r.problem("SEQ has %d symbols and does not end with '$'", len(I.SEQ))
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// The suffix array is a permutation of the positions, or of those that are
+// multiples of SA_RATE; row 0 holds "$" and row END_POS the whole text.
+//-----------------------------------------------------------------------------
+func (I *IndexC) verifySA(ctx context.Context, r *CheckResult, opt VerifyOptions) error {
+	if I.SA.Len() == 0 {
+		r.Skipped = "the index has no suffix array"
+		return nil
+	}
+	rate, size := indexType(1), I.LEN
+	if I.SA_RATE > 0 {
+		rate, size = I.SA_RATE, (I.LEN-1)/I.SA_RATE+1
+	}
+	if I.SA.Len() != size {
+		r.problem("SA has %d entries instead of %d", I.SA.Len(), size)
+		return nil
+	}
+	seen := NewBitVector(I.LEN)
+	for i := indexType(0); i < size; i++ {
+		if i%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p := I.SA.Get(i)
+		switch {
+		case p >= I.LEN || p%rate != 0:
+			r.problem("SA[%d] is %d, which is not a sampled position", i, p)
+		case seen.Get(p):
+			r.problem("SA has %d more than once", p)
+		default:
+			seen.Set(p)
+		}
+	}
+	if I.SA_RATE > 0 {
+		if I.SA_MARK.N != I.LEN {
+			r.problem("SA_MARK has %d bits instead of %d", I.SA_MARK.N, I.LEN)
+			return nil
+		}
+		if n := I.SA_MARK.Rank(I.LEN); n != size {
+			r.problem("SA_MARK marks %d rows instead of %d", n, size)
+			return nil
+		}
+	}
+	if len(r.Problems) > 0 || I.LEN == 0 || indexType(len(I.BWT)) != I.LEN {
+		return nil
+	}
+	if row := I.endRow(); row >= I.LEN {
+		r.problem("%d symbols are smaller than '$' in a text of length %d", row, I.LEN)
+	} else if p := I.Locate(row); p != I.LEN-1 {
+		r.problem("row %d holds position %d instead of %d", row, p, I.LEN-1)
+	}
+	if p := I.Locate(I.END_POS); p != 0 {
+		r.problem("row END_POS holds position %d instead of 0", p)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Every sequence id of SSA is that of a sequence, and that of the position
+// of its row, where the suffix array holds it.
+//-----------------------------------------------------------------------------
+func (I *IndexC) verifySSA(ctx context.Context, r *CheckResult, opt VerifyOptions) error {
+	if I.SSA.Len() == 0 {
+		r.Skipped = "the index has no SSA"
+		return nil
+	}
+	if I.SSA.Len() != I.LEN {
+		r.problem("SSA has %d entries instead of %d", I.SSA.Len(), I.LEN)
+		return nil
+	}
+	// Only a suffix array of the right size is used; verifySA checks it.
+	located := len(I.offsets) == len(I.LENS)
+	if I.SA_RATE == 0 {
+		located = located && I.SA.Len() == I.LEN
+	} else {
+		located = located && I.SA.Len() == (I.LEN-1)/I.SA_RATE+1 && I.SA_MARK.N == I.LEN
+	}
+	for i := indexType(0); i < I.LEN; i++ {
+		if i%check_interval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		k := I.SSA.Get(i)
+		if k >= indexType(len(I.LENS)) {
+			r.problem("SSA[%d] is %d, but there are %d sequences", i, k, len(I.LENS))
+			continue
+		}
+		if !located {
+			continue
+		}
+		var p indexType
+		switch {
+		case I.SA_RATE == 0:
+			p = I.SA.Get(i)
+		case I.SA_MARK.Get(i):
+			p = I.SA.Get(I.SA_MARK.Rank(i))
+		default:
+			continue
+		}
+		if p >= I.LEN {
+			continue
+		}
+		if g := I.sequenceAt(I.LEN - 2 - p); k != indexType(g) {
+			r.problem("SSA[%d] is %d, but position %d is in sequence %d", i, k, p, g)
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Reconstruct opt.Records random records by LF-walking the BWT, from the
+// nearest sampled ISA entry or from row 0, and compare them with SEQ.
+//-----------------------------------------------------------------------------
+func (I *IndexC) verifyRecords(ctx context.Context, r *CheckResult, opt VerifyOptions) error {
+	if len(I.SEQ) == 0 {
+		r.Skipped = "the index has no SEQ"
+		return nil
+	}
+	if opt.Records <= 0 {
+		r.Skipped = "no records were asked for"
+		return nil
+	}
+	if indexType(len(I.SEQ)) != I.LEN || indexType(len(I.BWT)) != I.LEN || len(I.offsets) != len(I.LENS) {
+		r.Skipped = "the sizes are wrong"
+		return nil
+	}
+	records := rand.New(rand.NewSource(opt.Seed)).Perm(len(I.LENS))
+	if len(records) > opt.Records {
+		records = records[:opt.Records]
+	}
+	// Records in text order are in descending order of SEQ, as the walk.
+	sort.Ints(records)
+
+	i, p := I.endRow(), I.LEN-1
+	if i >= I.LEN {
+		r.Skipped = "the symbol counts are wrong"
+		return nil
+	}
+	var steps int
+	for _, k := range records {
+		// Sequence k is SEQ[a:b] backwards.
+		a := I.LEN - 1 - I.offsets[k] - I.LENS[k]
+		b := I.LEN - 1 - I.offsets[k]
+		if I.ISA_RATE > 0 {
+			s := (I.LEN - 1 - b) / I.ISA_RATE
+			if q := I.LEN - 1 - s*I.ISA_RATE; q < p {
+				i, p = I.ISA.Get(s), q
+			}
+		}
+		same := true
+		for ; p > a; p-- {
+			if steps++; steps%check_interval == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if p <= b && same && I.BWT[i] != I.SEQ[p-1] {
+				r.problem("sequence %s differs from SEQ at %d", I.GENOME_ID[k], b-p)
+				same = false
+			}
+			i = I.lf(i)
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Returns the row of the suffix "$", which comes right after the suffixes
+// of smaller symbols.
+//-----------------------------------------------------------------------------
+func (I *IndexC) endRow() indexType {
+	var row indexType
+	for c, f := range I.Freq {
+		if c < '$' {
+			row += f
+		}
+	}
+	return row
+}
+
+//-----------------------------------------------------------------------------
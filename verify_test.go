@@ -0,0 +1,93 @@
+package fmic
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func verifyOK(t *testing.T, I *IndexC) {
+	t.Helper()
+	results, err := I.Verify(context.Background(), VerifyOptions{Records: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.OK() {
+			t.Errorf("check %s: %v and %d more", r.Name, r.Problems, r.More)
+		}
+	}
+}
+
+func TestVerifyValidIndexes(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	// LEN is 101 + 60 + 1 + 38 + 4 = 204, a multiple of 1, 2, 3, 4 and 6.
+	file := writeFasta(t, []string{randSeq(r, 101), randSeq(r, 60), "A", randSeq(r, 38)})
+	for _, opt := range []BuildOptions{
+		{Multiple: true, CompressionRatio: 1, ISARate: 1},
+		{Multiple: true, CompressionRatio: 4, ISARate: 3},
+		{Multiple: true, CompressionRatio: 5, SARate: 3},
+		{Multiple: true, CompressionRatio: 6, NoSSA: true, SARate: 7},
+		{Multiple: true, CompressionRatio: 2, NoSA: true},
+		{Multiple: true, CompressionRatio: 3, LCP: true},
+		{Multiple: true, CompressionRatio: 4, NoSSA: true, SARate: 4, MemoryBudget: 200},
+		{Multiple: true, CompressionRatio: 4, ISARate: 2, MemoryBudget: 200},
+	} {
+		I := buildIndex(t, file, opt)
+		if I.LEN != 204 {
+			t.Fatalf("LEN is %d", I.LEN)
+		}
+		verifyOK(t, I)
+		for save_option := 0; save_option <= 2; save_option++ {
+			if I.checkSaveOption(save_option) != nil {
+				continue
+			}
+			if err := I.SaveCompressedIndexContext(context.Background(), save_option, nil); err != nil {
+				t.Fatal(err)
+			}
+			L, err := LoadCompressedIndexContext(context.Background(), file+".fmi", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifyOK(t, L)
+		}
+	}
+}
+
+func TestVerifyFindsProblems(t *testing.T) {
+	b := NewIndexBuilder(BuildOptions{Multiple: true, CompressionRatio: 4})
+	b.AddReader("mem", strings.NewReader(">a\nACGTTGCAACGT\n>b\nGGGACTACG\n>c\nTTTTACG\n"))
+	I, err := b.Build(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	I.OCC['A'].Set(1, 77)
+	I.SSA.Set(5, (I.SSA.Get(5)+1)%3)
+	results, err := I.Verify(context.Background(), VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := map[string]bool{}
+	for _, r := range results {
+		failed[r.Name] = !r.OK()
+	}
+	if !failed["occ"] || !failed["ssa"] || failed["sa"] || failed["bwt"] {
+		t.Errorf("failed checks: %v", failed)
+	}
+}
+
+func TestVerifySymbolsBeforeEnd(t *testing.T) {
+	// '!' and '#' sort before '$', so the suffix "$" is not in row 0.
+	file := writeFasta(t, []string{"AC#GT!A", "#TTGA"})
+	for _, opt := range []BuildOptions{
+		{Multiple: true, CompressionRatio: 2},
+		{Multiple: true, CompressionRatio: 2, SARate: 3},
+	} {
+		I := buildIndex(t, file, opt)
+		if I.Locate(0) == I.LEN-1 {
+			t.Fatal("the suffix \"$\" is in row 0")
+		}
+		verifyOK(t, I)
+	}
+}
@@ -0,0 +1,976 @@
+/*
+   Copyright 2015 Vinhthuy Phan
+	Decompression of zstd streams (RFC 8878), without dictionaries.
+*/
+package fmic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Largest decompressed size of a block.
+const zstd_max_block = 128 << 10
+
+var (
+	errZstdCorrupt    = errors.New("zstd: corrupt input")
+	errZstdDictionary = errors.New("zstd: frames that need a dictionary are not supported")
+)
+
+//-----------------------------------------------------------------------------
+// zstdReader decompresses a sequence of zstd frames.  Skippable frames are
+// skipped, and checksums are verified.  Decoded bytes are kept for as long
+// as the frame may copy them.
+//-----------------------------------------------------------------------------
+type zstdReader struct {
+	in  *bufio.Reader
+	err error
+
+	hist        []byte // decoded bytes; those from pos on are not read yet
+	pos         int
+	frame_start int // start of the current frame in hist, or 0 if it was dropped
+
+	in_frame   bool
+	last_block bool
+	checksum   bool
+	window     int
+	size       int64 // content size of the frame, or -1 if it is not known
+	decoded    int64
+	digest     xxh64
+
+	block  []byte
+	lits   []byte
+	huff   huffmanTable
+	tables [3]fseTable  // tables of the literal lengths, offsets and match lengths
+	seq    [3]*fseTable // the tables of the last block with sequences, or nil
+	rep    [3]int       // repeated offsets
+}
+
+func newZstdReader(in *bufio.Reader) *zstdReader {
+	return &zstdReader{in: in}
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	for z.pos == len(z.hist) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n := copy(p, z.hist[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+//-----------------------------------------------------------------------------
+// Decode the next block, and the header of its frame if it is the first.
+// Returns io.EOF at the end of the last frame.
+//-----------------------------------------------------------------------------
+func (z *zstdReader) next() error {
+	if !z.in_frame {
+		if err := z.readFrameHeader(); err != nil {
+			return err
+		}
+	}
+	// Drop the read bytes that the frame can no longer copy.
+	keep := len(z.hist) - z.frame_start
+	if keep > z.window {
+		keep = z.window
+	}
+	if drop := len(z.hist) - keep; drop > 0 && drop >= keep {
+		copy(z.hist, z.hist[drop:])
+		z.hist, z.pos = z.hist[:keep], z.pos-drop
+		if z.frame_start -= drop; z.frame_start < 0 {
+			z.frame_start = 0
+		}
+	}
+	err := z.readBlock()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+//-----------------------------------------------------------------------------
+func (z *zstdReader) readFrameHeader() error {
+	var buf [8]byte
+	for {
+		if _, err := io.ReadFull(z.in, buf[:4]); err != nil {
+			return err
+		}
+		magic := binary.LittleEndian.Uint32(buf[:4])
+		if magic == 0xfd2fb528 {
+			break
+		}
+		if magic&0xfffffff0 != 0x184d2a50 {
+			return errors.New("zstd: unknown frame")
+		}
+		if _, err := io.ReadFull(z.in, buf[:4]); err != nil {
+			return unexpectedEOF(err)
+		}
+		if _, err := z.in.Discard(int(binary.LittleEndian.Uint32(buf[:4]))); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	read := func(n int) (uint64, error) {
+		buf = [8]byte{}
+		_, err := io.ReadFull(z.in, buf[:n])
+		return binary.LittleEndian.Uint64(buf[:]), unexpectedEOF(err)
+	}
+	desc, err := read(1)
+	if err != nil {
+		return err
+	}
+	single_segment := desc&0x20 != 0
+	if desc&0x08 != 0 {
+		return errZstdCorrupt
+	}
+	if !single_segment {
+		w, err := read(1)
+		if err != nil {
+			return err
+		}
+		log := 10 + w>>3
+		if log > 31 {
+			return errors.New("zstd: window is larger than 2 GB")
+		}
+		z.window = 1<<log + 1<<log/8*int(w&7)
+	}
+	if dict, err := read([]int{0, 1, 2, 4}[desc&3]); err != nil {
+		return err
+	} else if dict != 0 {
+		return errZstdDictionary
+	}
+	size_bytes := []int{0, 2, 4, 8}[desc>>6]
+	if size_bytes == 0 && single_segment {
+		size_bytes = 1
+	}
+	size, err := read(size_bytes)
+	if err != nil {
+		return err
+	}
+	z.size = int64(size)
+	if size_bytes == 0 {
+		z.size = -1
+	} else if size_bytes == 2 {
+		z.size += 256
+	}
+	if single_segment {
+		if z.size > 1<<31 {
+			return errors.New("zstd: window is larger than 2 GB")
+		}
+		z.window = int(z.size)
+	}
+
+	z.in_frame, z.last_block, z.checksum = true, false, desc&0x04 != 0
+	z.decoded, z.frame_start = 0, len(z.hist)
+	z.digest.reset()
+	z.huff.table = z.huff.table[:0]
+	z.seq = [3]*fseTable{}
+	z.rep = [3]int{1, 4, 8}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Decode a block at the end of hist.
+//-----------------------------------------------------------------------------
+func (z *zstdReader) readBlock() error {
+	var h [4]byte
+	if _, err := io.ReadFull(z.in, h[:3]); err != nil {
+		return err
+	}
+	header := binary.LittleEndian.Uint32(h[:])
+	size := int(header >> 3)
+	max_size := zstd_max_block
+	if z.window < max_size {
+		max_size = z.window
+	}
+	if size > max_size {
+		return errZstdCorrupt
+	}
+	z.last_block = header&1 != 0
+	start := len(z.hist)
+	switch header >> 1 & 3 {
+	case 0:
+		z.hist = append(z.hist, make([]byte, size)...)
+		if _, err := io.ReadFull(z.in, z.hist[start:]); err != nil {
+			return err
+		}
+	case 1:
+		c, err := z.in.ReadByte()
+		if err != nil {
+			return err
+		}
+		z.hist = append(z.hist, make([]byte, size)...)
+		for i := start; i < len(z.hist); i++ {
+			z.hist[i] = c
+		}
+	case 2:
+		if cap(z.block) < size {
+			z.block = make([]byte, zstd_max_block)
+		}
+		z.block = z.block[:size]
+		if _, err := io.ReadFull(z.in, z.block); err != nil {
+			return err
+		}
+		if err := z.decodeBlock(z.block, start+max_size); err != nil {
+			return err
+		}
+	default:
+		return errZstdCorrupt
+	}
+
+	z.decoded += int64(len(z.hist) - start)
+	if z.checksum {
+		z.digest.write(z.hist[start:])
+	}
+	if !z.last_block {
+		return nil
+	}
+	z.in_frame = false
+	if z.size >= 0 && z.decoded != z.size {
+		return errors.New("zstd: frame size does not match its header")
+	}
+	if z.checksum {
+		if _, err := io.ReadFull(z.in, h[:4]); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(h[:]) != uint32(z.digest.sum()) {
+			return errors.New("zstd: checksum mismatch")
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Decode a compressed block, which may not make hist longer than end.
+//-----------------------------------------------------------------------------
+func (z *zstdReader) decodeBlock(src []byte, end int) error {
+	lits, n, err := z.decodeLiterals(src)
+	if err != nil {
+		return err
+	}
+	src = src[n:]
+	if len(src) == 0 {
+		return errZstdCorrupt
+	}
+	num := int(src[0])
+	n = 1
+	if num >= 255 {
+		if len(src) < 3 {
+			return errZstdCorrupt
+		}
+		num, n = int(src[1])+int(src[2])<<8+0x7f00, 3
+	} else if num >= 128 {
+		if len(src) < 2 {
+			return errZstdCorrupt
+		}
+		num, n = (num-128)<<8+int(src[1]), 2
+	}
+	if num == 0 {
+		if n != len(src) || len(z.hist)+len(lits) > end {
+			return errZstdCorrupt
+		}
+		z.hist = append(z.hist, lits...)
+		return nil
+	}
+
+	if n >= len(src) || src[n]&3 != 0 {
+		return errZstdCorrupt
+	}
+	modes := src[n]
+	n++
+	for k := range z.seq {
+		switch modes >> (6 - 2*k) & 3 {
+		case 0:
+			z.seq[k] = &zstd_predefined[k]
+		case 1:
+			if n >= len(src) || int(src[n]) > len(zstd_codes[k].base)-1 {
+				return errZstdCorrupt
+			}
+			z.tables[k].rle(src[n])
+			z.seq[k] = &z.tables[k]
+			n++
+		case 2:
+			m, err := z.tables[k].read(src[n:], len(zstd_codes[k].base)-1, zstd_codes[k].max_log)
+			if err != nil {
+				return err
+			}
+			z.seq[k] = &z.tables[k]
+			n += m
+		case 3:
+			if z.seq[k] == nil {
+				return errZstdCorrupt
+			}
+		}
+	}
+	return z.execute(num, lits, src[n:], end)
+}
+
+//-----------------------------------------------------------------------------
+// Decode num sequences from src, and append their literals and matches to
+// hist.
+//-----------------------------------------------------------------------------
+func (z *zstdReader) execute(num int, lits, src []byte, end int) error {
+	br, err := newReverseBits(src)
+	if err != nil {
+		return err
+	}
+	ll, of, ml := z.seq[0], z.seq[1], z.seq[2]
+	ll_state := br.bits(ll.log)
+	of_state := br.bits(of.log)
+	ml_state := br.bits(ml.log)
+	for i := 0; i < num; i++ {
+		lc := ll.table[ll_state].sym
+		oc := of.table[of_state].sym
+		mc := ml.table[ml_state].sym
+		offset := 1<<oc + int(br.bits(oc))
+		match := int(zstd_codes[2].base[mc]) + int(br.bits(zstd_codes[2].extra[mc]))
+		lit := int(zstd_codes[0].base[lc]) + int(br.bits(zstd_codes[0].extra[lc]))
+		if i < num-1 {
+			ll_state = ll.next(ll_state, br)
+			ml_state = ml.next(ml_state, br)
+			of_state = of.next(of_state, br)
+		}
+
+		if offset > 3 {
+			offset -= 3
+			z.rep = [3]int{offset, z.rep[0], z.rep[1]}
+		} else {
+			k := offset
+			if lit > 0 {
+				k--
+			}
+			switch k {
+			case 0:
+				offset = z.rep[0]
+			case 1:
+				offset = z.rep[1]
+				z.rep[0], z.rep[1] = offset, z.rep[0]
+			case 2:
+				offset = z.rep[2]
+				z.rep = [3]int{offset, z.rep[0], z.rep[1]}
+			default:
+				offset = z.rep[0] - 1
+				z.rep = [3]int{offset, z.rep[0], z.rep[1]}
+			}
+		}
+
+		if lit > len(lits) || len(z.hist)+lit+match > end {
+			return errZstdCorrupt
+		}
+		z.hist = append(z.hist, lits[:lit]...)
+		lits = lits[lit:]
+		l := len(z.hist)
+		if offset <= 0 || offset > l-z.frame_start || offset > z.window {
+			return errZstdCorrupt
+		}
+		// The match repeats the offset bytes before it; copy in doubling
+		// steps so that short offsets are copied quickly.
+		z.hist = append(z.hist, make([]byte, match)...)
+		k := copy(z.hist[l:], z.hist[l-offset:l])
+		for k < match {
+			k += copy(z.hist[l+k:], z.hist[l:l+k])
+		}
+	}
+	if !br.finished() || len(z.hist)+len(lits) > end {
+		return errZstdCorrupt
+	}
+	z.hist = append(z.hist, lits...)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Decode the literals section of a block.  Returns the literals and the size
+// of the section.
+//-----------------------------------------------------------------------------
+func (z *zstdReader) decodeLiterals(src []byte) ([]byte, int, error) {
+	if len(src) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	kind, format := src[0]&3, src[0]>>2&3
+	if kind < 2 {
+		size, n := int(src[0]>>3), 1
+		if format == 1 {
+			n = 2
+		} else if format == 3 {
+			n = 3
+		}
+		if len(src) < n {
+			return nil, 0, errZstdCorrupt
+		}
+		if n > 1 {
+			size = int(src[0]>>4) + int(src[1])<<4
+		}
+		if n > 2 {
+			size += int(src[2]) << 12
+		}
+		if size > zstd_max_block {
+			return nil, 0, errZstdCorrupt
+		}
+		if kind == 0 {
+			if len(src) < n+size {
+				return nil, 0, errZstdCorrupt
+			}
+			return src[n : n+size], n + size, nil
+		}
+		if len(src) < n+1 {
+			return nil, 0, errZstdCorrupt
+		}
+		z.lits = append(z.lits[:0], make([]byte, size)...)
+		for i := range z.lits {
+			z.lits[i] = src[n]
+		}
+		return z.lits, n + 1, nil
+	}
+
+	var h [8]byte
+	n := []int{3, 3, 4, 5}[format]
+	if len(src) < n {
+		return nil, 0, errZstdCorrupt
+	}
+	copy(h[:], src[:n])
+	sizes := binary.LittleEndian.Uint64(h[:]) >> 4
+	width := []uint{10, 10, 14, 18}[format]
+	size := int(sizes & (1<<width - 1))
+	comp := int(sizes >> width & (1<<width - 1))
+	if size > zstd_max_block || len(src) < n+comp {
+		return nil, 0, errZstdCorrupt
+	}
+	data := src[n : n+comp]
+	if kind == 2 {
+		m, err := z.huff.read(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		data = data[m:]
+	} else if len(z.huff.table) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	z.lits = append(z.lits[:0], make([]byte, size)...)
+	if format == 0 {
+		return z.lits, n + comp, z.huff.decode(z.lits, data)
+	}
+
+	// Four streams, whose first three sizes are in a jump table.
+	if len(data) < 6 {
+		return nil, 0, errZstdCorrupt
+	}
+	var streams [4][]byte
+	rest := data[6:]
+	for k := 0; k < 3; k++ {
+		m := int(binary.LittleEndian.Uint16(data[2*k:]))
+		if m > len(rest) {
+			return nil, 0, errZstdCorrupt
+		}
+		streams[k], rest = rest[:m], rest[m:]
+	}
+	streams[3] = rest
+	part := (size + 3) / 4
+	if 3*part > size {
+		return nil, 0, errZstdCorrupt
+	}
+	for k, stream := range streams {
+		end := (k + 1) * part
+		if k == 3 {
+			end = size
+		}
+		if err := z.huff.decode(z.lits[k*part:end], stream); err != nil {
+			return nil, 0, err
+		}
+	}
+	return z.lits, n + comp, nil
+}
+
+//-----------------------------------------------------------------------------
+// Codes of the literal lengths, offsets and match lengths: the value of code
+// c is base[c] plus extra[c] more bits.
+//-----------------------------------------------------------------------------
+type zstdCodes struct {
+	base    []uint32
+	extra   []uint8
+	max_log uint8 // of their tables
+}
+
+var zstd_codes = [3]zstdCodes{
+	{
+		base: []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+			16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+			8192, 16384, 32768, 65536},
+		extra: []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+			13, 14, 15, 16},
+		max_log: 9,
+	},
+	// Offsets are decoded apart; only the number of codes matters.
+	{base: make([]uint32, 32), max_log: 8},
+	{
+		base: []uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+			19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+			35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+			4099, 8195, 16387, 32771, 65539},
+		extra: []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+			12, 13, 14, 15, 16},
+		max_log: 9,
+	},
+}
+
+// Tables of the predefined distributions.
+var zstd_predefined = [3]fseTable{
+	newFSETable(6, []int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1}),
+	newFSETable(5, []int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}),
+	newFSETable(6, []int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1}),
+}
+
+func newFSETable(log uint8, norm []int16) fseTable {
+	var t fseTable
+	if err := t.build(log, norm); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+//-----------------------------------------------------------------------------
+// fseTable decodes finite state entropy: the state is the row of the next
+// symbol, and the bits after it give the next state.
+//-----------------------------------------------------------------------------
+type fseTable struct {
+	log   uint8
+	table []fseEntry
+}
+
+type fseEntry struct {
+	sym  uint8
+	bits uint8
+	base uint16
+}
+
+func (t *fseTable) next(state uint64, br *reverseBits) uint64 {
+	e := t.table[state]
+	return uint64(e.base) + br.bits(e.bits)
+}
+
+// A table that only decodes sym.
+func (t *fseTable) rle(sym byte) {
+	t.log = 0
+	t.table = append(t.table[:0], fseEntry{sym: sym})
+}
+
+//-----------------------------------------------------------------------------
+// Read the description of a table from the start of src, whose symbols are
+// at most max_sym.  Returns the size of the description.
+//-----------------------------------------------------------------------------
+func (t *fseTable) read(src []byte, max_sym int, max_log uint8) (int, error) {
+	pos := 0 // in bits
+	peek := func(n int) int {
+		var v uint64
+		for i := 0; i < 5 && pos/8+i < len(src); i++ {
+			v |= uint64(src[pos/8+i]) << (8 * i)
+		}
+		return int(v >> (pos % 8) & (1<<n - 1))
+	}
+	log := uint8(peek(4)) + 5
+	pos += 4
+	if log > max_log {
+		return 0, errZstdCorrupt
+	}
+	var norm [256]int16
+	remaining, threshold, width := 1<<log+1, 1<<log, int(log)+1
+	sym, zero := 0, false
+	for remaining > 1 && sym <= max_sym {
+		if zero {
+			// A zero count is followed by the number of zeros after it.
+			for peek(2) == 3 {
+				sym += 3
+				pos += 2
+			}
+			sym += peek(2)
+			pos += 2
+			if sym > max_sym {
+				return 0, errZstdCorrupt
+			}
+		}
+		max := 2*threshold - 1 - remaining
+		count := peek(width)
+		if count&(threshold-1) < max {
+			count &= threshold - 1
+			pos += width - 1
+		} else {
+			if count >= threshold {
+				count -= max
+			}
+			pos += width
+		}
+		count--
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		if remaining < 1 {
+			return 0, errZstdCorrupt
+		}
+		norm[sym] = int16(count)
+		sym++
+		zero = count == 0
+		for remaining < threshold {
+			width--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || pos > 8*len(src) {
+		return 0, errZstdCorrupt
+	}
+	return (pos + 7) / 8, t.build(log, norm[:sym])
+}
+
+//-----------------------------------------------------------------------------
+// Build the table of the normalized counts norm, which add up to 1<<log; a
+// count of -1 stands for a symbol of probability less than 1>>log.
+//-----------------------------------------------------------------------------
+func (t *fseTable) build(log uint8, norm []int16) error {
+	size := 1 << log
+	t.log = log
+	if cap(t.table) < size {
+		t.table = make([]fseEntry, size)
+	}
+	t.table = t.table[:size]
+	var next [256]int
+	high := size - 1
+	for s, c := range norm {
+		if c == -1 {
+			t.table[high].sym = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = int(c)
+		}
+	}
+	step, pos := size>>1+size>>3+3, 0
+	for s, c := range norm {
+		for i := 0; i < int(c); i++ {
+			t.table[pos].sym = uint8(s)
+			for pos = (pos + step) & (size - 1); pos > high; pos = (pos + step) & (size - 1) {
+			}
+		}
+	}
+	if pos != 0 {
+		return errZstdCorrupt
+	}
+	for u := range t.table {
+		s := t.table[u].sym
+		x := next[s]
+		next[s]++
+		width := int(log) + 1 - bits.Len(uint(x))
+		t.table[u].bits = uint8(width)
+		t.table[u].base = uint16(x<<width - size)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// huffmanTable decodes literals: the next log bits of a stream are the row
+// of the next literal, whose code is the first bits of them.
+//-----------------------------------------------------------------------------
+type huffmanTable struct {
+	log   uint
+	table []huffmanEntry
+}
+
+type huffmanEntry struct {
+	sym  uint8
+	bits uint8
+}
+
+//-----------------------------------------------------------------------------
+// Read the description of a table from the start of src: the weights of the
+// symbols but the last, either 4 bits each or compressed with FSE.  Returns
+// the size of the description.
+//-----------------------------------------------------------------------------
+func (h *huffmanTable) read(src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, errZstdCorrupt
+	}
+	var weights [256]uint8
+	num, n := 0, 1+int(src[0])
+	if src[0] >= 128 {
+		num = int(src[0]) - 127
+		n = 1 + (num+1)/2
+		if len(src) < n {
+			return 0, errZstdCorrupt
+		}
+		for i := 0; i < num; i++ {
+			weights[i] = src[1+i/2] >> 4
+			if i%2 == 1 {
+				weights[i] = src[1+i/2] & 15
+			}
+		}
+	} else {
+		if len(src) < n {
+			return 0, errZstdCorrupt
+		}
+		var err error
+		if num, err = decodeWeights(src[1:n], &weights); err != nil {
+			return 0, err
+		}
+	}
+
+	// The weight of the last symbol fills the total up to a power of 2.
+	total := 0
+	for _, w := range weights[:num] {
+		if w > 11 {
+			return 0, errZstdCorrupt
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return 0, errZstdCorrupt
+	}
+	log := bits.Len(uint(total))
+	left := 1<<log - total
+	if log > 11 || left&(left-1) != 0 {
+		return 0, errZstdCorrupt
+	}
+	weights[num] = uint8(bits.Len(uint(left)))
+	num++
+
+	// Longer codes come first, and symbols of the same length in order.
+	h.log = uint(log)
+	h.table = append(h.table[:0], make([]huffmanEntry, 1<<log)...)
+	var start [13]int
+	for _, w := range weights[:num] {
+		if w > 0 {
+			start[w] += 1 << (w - 1)
+		}
+	}
+	for w, sum := 1, 0; w <= log; w++ {
+		start[w], sum = sum, sum+start[w]
+	}
+	for s, w := range weights[:num] {
+		if w == 0 {
+			continue
+		}
+		e := huffmanEntry{sym: uint8(s), bits: uint8(log + 1 - int(w))}
+		for i := 0; i < 1<<(w-1); i++ {
+			h.table[start[w]+i] = e
+		}
+		start[w] += 1 << (w - 1)
+	}
+	return n, nil
+}
+
+//-----------------------------------------------------------------------------
+// Decode the weights of a Huffman table compressed with FSE, which are the
+// symbols of two interleaved states.  Returns the number of weights.
+//-----------------------------------------------------------------------------
+func decodeWeights(src []byte, weights *[256]uint8) (int, error) {
+	var t fseTable
+	n, err := t.read(src, 255, 6)
+	if err != nil {
+		return 0, err
+	}
+	br, err := newReverseBits(src[n:])
+	if err != nil {
+		return 0, err
+	}
+	states := [2]uint64{br.bits(t.log), br.bits(t.log)}
+	num := 0
+	for k := 0; ; k ^= 1 {
+		if num > 253 {
+			return 0, errZstdCorrupt
+		}
+		weights[num] = t.table[states[k]].sym
+		num++
+		states[k] = t.next(states[k], br)
+		if br.overflowed() {
+			weights[num] = t.table[states[k^1]].sym
+			return num + 1, nil
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Decode len(dst) literals from a stream.
+//-----------------------------------------------------------------------------
+func (h *huffmanTable) decode(dst, src []byte) error {
+	br, err := newReverseBits(src)
+	if err != nil {
+		return err
+	}
+	for i := range dst {
+		if br.used+h.log > 64 {
+			br.fill()
+		}
+		e := h.table[br.value<<br.used>>(64-h.log)]
+		dst[i] = e.sym
+		br.used += uint(e.bits)
+	}
+	if !br.finished() {
+		return errZstdCorrupt
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// reverseBits reads a bit stream from its end: the last byte starts with
+// zeros and a 1, and then each value is read from its most significant bit.
+// Past the start of the stream, it reads zeros.
+//-----------------------------------------------------------------------------
+type reverseBits struct {
+	in    []byte
+	off   int    // in[:off] is not in value yet
+	value uint64 // the bits of in[off:] that fit, last first
+	used  uint   // bits of value that were read
+}
+
+func newReverseBits(in []byte) (*reverseBits, error) {
+	if len(in) == 0 || in[len(in)-1] == 0 {
+		return nil, errZstdCorrupt
+	}
+	br := &reverseBits{in: in, off: len(in), used: 64}
+	br.fill()
+	br.used += uint(9 - bits.Len8(in[len(in)-1]))
+	return br, nil
+}
+
+func (br *reverseBits) fill() {
+	for br.used >= 8 && br.off > 0 {
+		if br.used >= 32 && br.off >= 4 {
+			br.off -= 4
+			br.value = br.value<<32 | uint64(binary.LittleEndian.Uint32(br.in[br.off:]))
+			br.used -= 32
+		} else {
+			br.off--
+			br.value = br.value<<8 | uint64(br.in[br.off])
+			br.used -= 8
+		}
+	}
+}
+
+func (br *reverseBits) bits(n uint8) uint64 {
+	if br.used+uint(n) > 64 {
+		br.fill()
+	}
+	v := br.value << br.used >> (64 - n)
+	br.used += uint(n)
+	return v
+}
+
+// Whether every bit was read.
+func (br *reverseBits) finished() bool {
+	return br.off == 0 && br.used == 64
+}
+
+// Whether bits were read past the start of the stream.
+func (br *reverseBits) overflowed() bool {
+	return br.off == 0 && br.used > 64
+}
+
+//-----------------------------------------------------------------------------
+// xxh64 is the 64-bit xxHash of the bytes written to it, with seed 0.
+//-----------------------------------------------------------------------------
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int
+}
+
+const (
+	xxh_prime1 uint64 = 11400714785074694791
+	xxh_prime2 uint64 = 14029467366897019727
+	xxh_prime3 uint64 = 1609587929392839161
+	xxh_prime4 uint64 = 9650029242287828579
+	xxh_prime5 uint64 = 2870177450012600261
+)
+
+func xxhRound(acc, input uint64) uint64 {
+	return bits.RotateLeft64(acc+input*xxh_prime2, 31) * xxh_prime1
+}
+
+func (x *xxh64) reset() {
+	*x = xxh64{v: [4]uint64{xxh_prime1, xxh_prime2, 0, 0}}
+	x.v[0] += xxh_prime2
+	x.v[3] -= xxh_prime1
+}
+
+func (x *xxh64) write(b []byte) {
+	x.total += uint64(len(b))
+	if x.n > 0 {
+		k := copy(x.mem[x.n:], b)
+		x.n += k
+		b = b[k:]
+		if x.n < 32 {
+			return
+		}
+		x.stripe(x.mem[:])
+		x.n = 0
+	}
+	for ; len(b) >= 32; b = b[32:] {
+		x.stripe(b)
+	}
+	x.n = copy(x.mem[:], b)
+}
+
+func (x *xxh64) stripe(b []byte) {
+	for k := range x.v {
+		x.v[k] = xxhRound(x.v[k], binary.LittleEndian.Uint64(b[8*k:]))
+	}
+}
+
+func (x *xxh64) sum() uint64 {
+	var h uint64
+	if x.total >= 32 {
+		h = bits.RotateLeft64(x.v[0], 1) + bits.RotateLeft64(x.v[1], 7) +
+			bits.RotateLeft64(x.v[2], 12) + bits.RotateLeft64(x.v[3], 18)
+		for _, v := range x.v {
+			h = (h^xxhRound(0, v))*xxh_prime1 + xxh_prime4
+		}
+	} else {
+		h = x.v[2] + xxh_prime5
+	}
+	h += x.total
+	b := x.mem[:x.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxhRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxh_prime1 + xxh_prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxh_prime1
+		h = bits.RotateLeft64(h, 23)*xxh_prime2 + xxh_prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxh_prime5
+		h = bits.RotateLeft64(h, 11) * xxh_prime1
+	}
+	h ^= h >> 33
+	h *= xxh_prime2
+	h ^= h >> 29
+	h *= xxh_prime3
+	h ^= h >> 32
+	return h
+}
+
+//-----------------------------------------------------------------------------
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,146 @@
+package fmic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testLCG returns n bases drawn with the rand() of the C standard, seeded with
+// x.  The fixtures below were compressed from it with the zstd command.
+func testLCG(x uint32, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		x = (x*1103515245 + 12345) & 0x7fffffff
+		b[i] = "ACGT"[x>>16&3]
+	}
+	return string(b)
+}
+
+// ">r0 first" and ">r1" compressed with -19 --check: Huffman literals in four
+// streams, and a checksum.
+const zstd_fixture = "" +
+	"28b52ffd648c14dd1e005acab40e10b027c30192f0c2e3ce9455cd93a6e527e700e500e2" +
+	"009fab92546d49e7391dcfffa57365d2a694c714b7da146fd39d4ddc6ce62b5f725ff6ce" +
+	"b9dd1cebb5137b5d8b1a4f551dbfef7a2fa3a614339f5c52a668ca5b2bbbbebc7566bad8" +
+	"99a4d1f4246bde744f6aed2a39e7546772d1a4574c3257ce9cd7d2361b53ae2bbfbff2ca" +
+	"74c7a295bff3312b45d54e3ae6b2683193d57bf3a4f4b9d2275566fb7cca25b1cdb78a7e" +
+	"e6ce924daf937659adb3e6937c5be2a6cf89993771ad9cd3935d694f5fe2277d9ae8da57" +
+	"a5fe2e5b9793122ddfd21463963537b76ca752fa24b7a251adac7fad9ea4e797a47c2db1" +
+	"fdd5ee9233fba7e360280a0440a02002dba76eaf24e7c4b21c2d263997eb4eb5123ff7f9" +
+	"4ba9897d929cc4bc67fc63562edf97eeb29b5c494d16f357ce89c74c8c31a6c9d99c6cbb" +
+	"92ce37ff9bd6ba363b5af6f4f48b29494fedc99749a229b9e458c73db53dedfc766e9dea" +
+	"9cd3996bee5cc7b29ab18fd1fc94d61e4f7d54f32439a6af2d19d5ad8c6f922ca54b961e" +
+	"ebd69c2abb3d7fd2299ff963ae624c3a5e9b65359ff29bc49434d5674e46cf25694a49b1" +
+	"7296f689b59af7188f9f74ce9996a559dd4a529d693b775fa3a94eb5d444134d3c9fc536" +
+	"b6c9e763d29b65cc49faf4492c655276529bf19ce4e935f964cdb1e46369ba6a2965d39e" +
+	"f613fd7a7dafcdd43bdf34d14ecc8f27eeefae494a396e923f3b2bb32c96938a9ef4cc4e" +
+	"b525be9d589d78f464f9d29297fe3a9edef2f6b71b4b32e53c7dd13dcd6ceeb79d3549b3" +
+	"92944992d5b14a7dc74ba9b5ff2c69c6ca732af944af37df9f72c67c3c9ae54d9fbbd6f4" +
+	"e594fa945cdcfa7c8ee9d249453fc7f34cb1ace7735bce4b3173b7ed94dc665251d3c6f3" +
+	"c59cb3adfd5ab154ce744acdc4921a5ddd4ed2943e16bff866d92465b34eb599d2c9f637" +
+	"d192fc27c9a6dd25ad899a7ef9d7e49dab3b27f14b65138df1dbde3a63ae7da6b47f8966" +
+	"62960723e99366bfc62b7f49d993e94a8cfea6a3162ff666dfe4934d26c64fe62531da6a" +
+	"dca474a9d5c9c75d4d927edddb24d777f27559cae5ac49798be7182db7aaa5897e196362" +
+	"27a752ae2a95dbb5533149ce492a3b17d30f86a020869918bf8ce692cef2b2499bf2dd96" +
+	"deef2ac7a43e493ae598b25cd672573c998f9589a5e4a2f924e5c598a768eacd323933d3" +
+	"a9c4b5947e6fd27aa2d6a7ec3f9adfb4966f974d2ce6bbecbc7c3cfdb4d8a6e924b1f45a" +
+	"92fc5aac642efdd7ebf6ec793d291e3545edcabccdd94aca9344cf2b45f792de649a39c7" +
+	"6c71637b8e899fbb4ffc6c476d3b59ac9424270b00b87055c14276bb834fb761fd8a1429" +
+	"5450244afa29d3623d99390aefa24244d9db5d64e2c3883005885c8634"
+
+// ">r2" compressed with -1, which stores it in a raw block.
+const zstd_fixture2 = "28b52ffd240d6900003e72320a41434754544743410aadd6c3fe"
+
+func zstdFixture(t *testing.T) []byte {
+	var data []byte
+	// The frames are separated by a skippable frame of 3 bytes.
+	for _, h := range []string{zstd_fixture, "502a4d1803000000616263", zstd_fixture2} {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b...)
+	}
+	return data
+}
+
+func TestReadZstdFasta(t *testing.T) {
+	a := testLCG(1, 2000)
+	want := map[string]string{
+		"r0": a + testLCG(2, 1000) + a[:1500],
+		"r1": strings.Repeat("N", 700) + testLCG(3, 300),
+		"r2": "ACGTTGCA",
+	}
+	file := filepath.Join(t.TempDir(), "test.fa.zst")
+	if err := os.WriteFile(file, zstdFixture(t), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	err := readFastaRecords(context.Background(), file, nil, func(id, des string, seq []byte) error {
+		ids = append(ids, id)
+		if string(seq) != want[id] {
+			t.Errorf("%s has %d bases instead of %d", id, len(seq), len(want[id]))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, " ") != "r0 r1 r2" {
+		t.Errorf("records %v", ids)
+	}
+}
+
+func TestZstdErrors(t *testing.T) {
+	data := zstdFixture(t)
+	n := len(zstd_fixture) / 2
+	read := func(data []byte) error {
+		_, err := ioutil.ReadAll(newZstdReader(bufio.NewReader(bytes.NewReader(data))))
+		return err
+	}
+	if err := read(data); err != nil {
+		t.Fatal(err)
+	}
+	bad := append([]byte(nil), data...)
+	bad[n-1] ^= 1
+	if err := read(bad); err == nil || err.Error() != "zstd: checksum mismatch" {
+		t.Errorf("checksum: %v", err)
+	}
+	for _, size := range []int{n - 3, n + 5, len(data) - 1} {
+		if err := read(data[:size]); err == nil {
+			t.Errorf("%d of %d bytes read without error", size, len(data))
+		}
+	}
+	for i := 4; i < n; i += 7 {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0x10
+		read(bad) // must not panic
+	}
+}
+
+// Longer inputs are checked by the checksum of zstd_fixture.
+func TestXXH64(t *testing.T) {
+	for _, c := range []struct {
+		in  string
+		sum uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"abc", 0x44bc2cf5ad770999},
+	} {
+		var x xxh64
+		x.reset()
+		for _, part := range []string{c.in[:len(c.in)/3], c.in[len(c.in)/3:]} {
+			x.write([]byte(part))
+		}
+		if x.sum() != c.sum {
+			t.Errorf("xxh64(%q) = %x", c.in, x.sum())
+		}
+	}
+}